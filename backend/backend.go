@@ -2,19 +2,29 @@ package backend
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	backend "github.com/bhoriuchi/terraform-backend-http/go"
+	"github.com/bhoriuchi/terraform-backend-http/go/store"
+	"github.com/bhoriuchi/terraform-backend-http/go/types"
 	"github.com/echocat/slf4g"
 	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
 	"github.com/echocat/terraform-provider-bitwarden/plugin"
 	"github.com/echocat/terraform-provider-bitwarden/utils"
+	"golang.org/x/crypto/ssh/terminal"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func NewBackend(p *plugin.Plugin) *Backend {
@@ -37,11 +47,30 @@ type Backend struct {
 
 	config        *Config
 	overlayConfig *Config
+	workspace     string
 	plugin        *plugin.Plugin
 	bitwarden     *bitwarden.Bitwarden
 	backend       *backend.Backend
+	store         *Store
 	server        *http.Server
 	listener      net.Listener
+	serveErr      chan error
+	credentials   serverCredentials
+	certificate   *serverCertificate
+	variablesFile string
+	variablesDir  string
+
+	ignoreStateConflicts bool
+	serving              bool
+	runMetadata          map[string]interface{}
+	runMetadataOnce      sync.Once
+
+	// handleMutex serializes all calls of the Bitwarden CLI caused by requests
+	// and the heartbeat of held locks.
+	handleMutex   sync.Mutex
+	heldLocks     map[string]types.Lock
+	heartbeatDone chan struct{}
+	lastRequest   time.Time
 }
 
 func (this *Backend) RegisterFlags(app *kingpin.Application) {
@@ -51,12 +80,18 @@ func (this *Backend) RegisterFlags(app *kingpin.Application) {
 	app.Flag("item.name", "Item ID which holds the state of this terraform environment.").
 		Envar("TF_BACKEND_ITEM_ID").
 		StringVar(&this.overlayConfig.State.ItemId)
-	app.Flag("listen", "Port where the backend is listening while the execution to (at localhost).").
+	app.Flag("listen", "Port where the backend is listening while the execution to (at localhost); 'auto' or 0 chooses a free one.").
 		Envar("TF_BACKEND_PORT").
-		Uint16Var(&this.overlayConfig.Backend.Port)
+		SetValue(&this.overlayConfig.Backend.Port)
 	app.Flag("terraform.executable", "Executable of Terraform to execute (if required).").
 		Envar("TF_EXECUTABLE").
 		SetValue(&this.overlayConfig.Terraform.Executable)
+	app.Flag("terraform.flavor", "Flavor of Terraform to execute (terraform or opentofu; detected by the executable by default).").
+		Envar("TF_FLAVOR").
+		SetValue(&this.overlayConfig.Terraform.Flavor)
+	app.Flag("terraform.variables", "How variables are passed to Terraform: environment (TF_VAR_*, default), auto_tfvars or var_file.").
+		Envar("TF_BACKEND_VARIABLES_MODE").
+		SetValue(&this.overlayConfig.Terraform.VariablesMode)
 	app.Flag("bitwarden.executable", "Executable of Bitwarden CLI to use.").
 		Envar("BW_CLI_EXECUTABLE").
 		StringVar(&this.overlayConfig.Bitwarden.Executable)
@@ -67,6 +102,10 @@ func (this *Backend) RegisterFlags(app *kingpin.Application) {
 		Envar("BW_UNLOCK").
 		BoolVar(this.overlayConfig.Bitwarden.UnlockIfRequired)
 
+	app.Flag("state.force", "Writes states even if their lineage or serial does not succeed the stored one.").
+		Envar("TF_BACKEND_STATE_FORCE").
+		BoolVar(&this.ignoreStateConflicts)
+
 	cmd := app.Command("wrap", "Starts the backend and calls terraform accordingly.").
 		Default().
 		Action(this.cmdExecute)
@@ -75,6 +114,12 @@ func (this *Backend) RegisterFlags(app *kingpin.Application) {
 		StringsVar(&this.TerraformArgs)
 
 	this.plugin.RegisterFlags(cmd)
+
+	(&workspaceCommands{Backend: this}).register(app)
+	(&stateCommands{Backend: this}).register(app)
+	(&lockCommands{Backend: this}).register(app)
+	(&serveCommand{Backend: this}).register(app)
+	(&execCommand{Backend: this}).register(app)
 }
 
 func (this *Backend) cmdExecute(*kingpin.ParseContext) (rErr error) {
@@ -91,20 +136,62 @@ func (this *Backend) cmdExecute(*kingpin.ParseContext) (rErr error) {
 }
 
 func (this *Backend) runTerraform() error {
+	// Signals must not terminate this process directly; otherwise Close
+	// would not be called and secrets written for Terraform would remain.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
 	executable := this.config.GetTerraform().GetExecutable()
-	cmd, err := executable.Command(this.TerraformArgs...)
+	env, err := this.terraformEnvironment()
 	if err != nil {
 		return executable.Errorf(this.TerraformArgs, "%w", err)
 	}
+	args := this.terraformArguments()
+	cmd, err := executable.Command(args...)
+	if err != nil {
+		return executable.Errorf(args, "%w", err)
+	}
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	cmd.Env, err = this.terraformEnvironment()
-	if err != nil {
-		return executable.Errorf(this.TerraformArgs, "%w", err)
+	cmd.Env = env
+
+	select {
+	case sig := <-signals:
+		return executable.Errorf(args, "interrupted by %v before start", sig)
+	default:
 	}
 
-	err = cmd.Run()
+	if err := cmd.Start(); err != nil {
+		return executable.Errorf(args, "%w", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	for waiting := true; waiting; {
+		select {
+		case err = <-done:
+			waiting = false
+		case sig := <-signals:
+			// Terraform stops gracefully (and releases its lock) on its own.
+			// An interrupt from a terminal was already received by Terraform
+			// as well; a second one would stop it immediately.
+			if sig != os.Interrupt || !terminal.IsTerminal(int(os.Stdin.Fd())) {
+				_ = cmd.Process.Signal(sig)
+			}
+			log.With("signal", sig.String()).
+				Info("Received signal; waiting for Terraform to stop.")
+		case sErr := <-this.serveErr:
+			// Without the server the state can neither be read nor written
+			// anymore; so there is no point to let Terraform continue.
+			_ = cmd.Process.Kill()
+			<-done
+			return executable.Errorf(args, "backend server failed: %w", sErr)
+		}
+	}
 	if eErr, ok := err.(*exec.ExitError); ok {
 		this.ExitCode = eErr.ExitCode()
 		return nil
@@ -115,16 +202,9 @@ func (this *Backend) runTerraform() error {
 }
 
 func (this *Backend) Initialize() error {
-	if err := this.config.Read(nil); err != nil {
+	if err := this.initializeConfig(); err != nil {
 		return err
 	}
-	nc := this.overlayConfig.Merge(*this.config)
-
-	if err := nc.Validate(); err != nil {
-		return err
-	}
-
-	this.config = &nc
 
 	var success bool
 	if err := this.plugin.Initialize(); err != nil {
@@ -136,12 +216,24 @@ func (this *Backend) Initialize() error {
 		}
 	}()
 
+	if err := this.initializeServer(); err != nil {
+		return err
+	}
+
+	success = true
+	return nil
+}
+
+// initializeServer initializes Bitwarden and starts the server of the
+// backend. The configuration has to be already initialized.
+func (this *Backend) initializeServer() error {
 	b, err := this.newBitwarden()
 	if err != nil {
 		return err
 	}
 
-	this.backend = backend.NewBackend(&Store{this}, &backend.Options{
+	this.store = &Store{StoreParent: this}
+	this.backend = backend.NewBackend(this.store, &backend.Options{
 		Logger:          this.logHook,
 		GetMetadataFunc: this.getMetaDataHook,
 		GetRefFunc:      this.getRefHook,
@@ -154,20 +246,80 @@ func (this *Backend) Initialize() error {
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if !success {
-			_ = s.Close()
-		}
-	}()
 
 	this.bitwarden = b
 	this.listener = ln
 	this.server = s
 
-	success = true
+	if ttl := this.config.GetState().GetLockTtl(); ttl > 0 {
+		this.startLockHeartbeat(ttl)
+	}
+
+	return nil
+}
+
+func (this *Backend) initializeConfig() error {
+	return this.initializeConfigFor(true)
+}
+
+// initializeConfigFor reads and validates the configuration. Only if
+// withWorkspace is true the current workspace is determined and the item of
+// its state has to be configured.
+func (this *Backend) initializeConfigFor(withWorkspace bool) error {
+	if err := this.config.Read(nil); err != nil {
+		return err
+	}
+	nc := this.overlayConfig.Merge(*this.config)
+
+	if err := nc.Validate(); err != nil {
+		return err
+	}
+	tc := nc.GetTerraform()
+	tc.Executable = tc.GetExecutable()
+	nc.Terraform = &tc
+
+	if withWorkspace {
+		workspace, err := currentWorkspace()
+		if err != nil {
+			return err
+		}
+		if _, err := nc.GetState().StoreRefOfWorkspace(workspace); err != nil {
+			return fmt.Errorf("workspace %s: %w", workspace, err)
+		}
+		this.workspace = workspace
+	}
+
+	this.config = &nc
 	return nil
 }
 
+// withClient initializes only the configuration and Bitwarden itself (without
+// plugin and server) and executes the given action with it.
+func (this *Backend) withClient(action func(b *bitwarden.Bitwarden) error) error {
+	return this.withClientFor(true, action)
+}
+
+// withClientFor is like withClient, but only if withWorkspace is true the
+// current workspace is determined and the item of its state has to be
+// configured (see initializeConfigFor).
+func (this *Backend) withClientFor(withWorkspace bool, action func(b *bitwarden.Bitwarden) error) (rErr error) {
+	if err := this.initializeConfigFor(withWorkspace); err != nil {
+		return err
+	}
+	b, err := this.newBitwarden()
+	if err != nil {
+		return err
+	}
+	this.bitwarden = b
+	defer func() {
+		if err := this.Close(); err != nil && rErr == nil {
+			rErr = err
+		}
+	}()
+
+	return action(b)
+}
+
 func (this *Backend) newBitwarden() (*bitwarden.Bitwarden, error) {
 	bc := this.config.GetBitwarden()
 	b, err := bc.NewBitwarden()
@@ -208,42 +360,84 @@ func (this *Backend) getRefHook(r *http.Request) string {
 	return r.URL.Query().Get("item")
 }
 
-func (this *Backend) getMetaDataHook(map[string]interface{}) map[string]interface{} {
-	return map[string]interface{}{}
+func (this *Backend) getMetaDataHook(state map[string]interface{}) map[string]interface{} {
+	this.runMetadataOnce.Do(func() {
+		// While serving, the command line is the one of the backend itself
+		// and says nothing about the client which writes the state.
+		var commandLine []string
+		if !this.serving {
+			commandLine = append([]string{this.config.GetTerraform().GetExecutable().String()}, this.TerraformArgs...)
+		}
+		this.runMetadata = newRunMetadata(commandLine)
+	})
+	return stateMetadataOf(this.runMetadata, state)
 }
 
 func (this *Backend) newServer() (*http.Server, net.Listener, error) {
+	if this.credentials.password == "" {
+		credentials, err := newServerCredentials()
+		if err != nil {
+			return nil, nil, err
+		}
+		this.credentials = credentials
+	}
+
 	server := &http.Server{
 		Addr:    fmt.Sprintf("127.0.0.1:%d", this.config.GetBackend().GetPort()),
 		Handler: http.HandlerFunc(this.handle),
 	}
 	ln, err := net.Listen("tcp", server.Addr)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("cannot listen on %s: %w", server.Addr, err)
 	}
 
+	if this.config.GetBackend().IsTls() {
+		certificate, err := newServerCertificate()
+		if err != nil {
+			_ = ln.Close()
+			return nil, nil, err
+		}
+		this.certificate = certificate
+		ln = tls.NewListener(ln, &tls.Config{
+			Certificates: []tls.Certificate{certificate.certificate},
+			MinVersion:   tls.VersionTLS12,
+		})
+	}
+
+	serveErr := make(chan error, 1)
 	go func() {
 		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
 			log.WithError(err).
-				With("address", this.server.Addr).
-				Error("Failed to listen.")
-			os.Exit(67)
+				With("address", ln.Addr().String()).
+				Error("Backend server stopped unexpectedly.")
+			serveErr <- err
 		}
 	}()
+	this.serveErr = serveErr
 
 	return server, ln, err
 }
 
 func (this *Backend) handle(w http.ResponseWriter, r *http.Request) {
+	if !this.credentials.isAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="terraform-backend-bitwarden"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	this.handleMutex.Lock()
+	defer this.handleMutex.Unlock()
+	this.lastRequest = time.Now()
+
 	switch r.Method {
 	case "LOCK":
-		this.backend.HandleLockState(w, r)
+		this.handleLockState(w, r)
 	case "UNLOCK":
-		this.backend.HandleUnlockState(w, r)
+		this.handleUnlockState(w, r)
 	case http.MethodGet:
 		this.backend.HandleGetState(w, r)
 	case http.MethodPost:
-		this.backend.HandleUpdateState(w, r)
+		this.handleUpdateState(w, r)
 	case http.MethodDelete:
 		this.backend.HandleDeleteState(w, r)
 	default:
@@ -251,7 +445,187 @@ func (this *Backend) handle(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleUpdateState writes the state if the request holds the lock (or the
+// state is not locked at all).
+func (this *Backend) handleUpdateState(w http.ResponseWriter, r *http.Request) {
+	ref := this.getRefHook(r)
+
+	var state map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+		log.WithError(err).
+			With("ref", ref).
+			Error("Cannot decode body of update request.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := this.checkLock(ref, r.URL.Query().Get("ID")); err != nil {
+		this.respondWithError(w, ref, "Cannot check lock of state.", err)
+		return
+	}
+
+	if err := this.store.PutState(ref, state, this.getMetaDataHook(state), false); err != nil {
+		this.respondWithError(w, ref, "Cannot write state.", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleLockState acquires the lock and remembers it to renew it while it is
+// held.
+func (this *Backend) handleLockState(w http.ResponseWriter, r *http.Request) {
+	ref := this.getRefHook(r)
+
+	var lock types.Lock
+	if err := json.NewDecoder(r.Body).Decode(&lock); err != nil {
+		log.WithError(err).
+			With("ref", ref).
+			Error("Cannot decode body of lock request.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// PutLock refuses the lock itself if someone else holds it.
+	if err := this.store.PutLock(ref, lock); err != nil {
+		this.respondWithError(w, ref, "Cannot acquire lock.", err)
+		return
+	}
+
+	if this.heldLocks == nil {
+		this.heldLocks = map[string]types.Lock{}
+	}
+	this.heldLocks[ref] = lock
+	w.WriteHeader(http.StatusOK)
+}
+
+// checkLock returns a LockHeldError if the state is locked with another ID
+// than the given one.
+func (this *Backend) checkLock(ref, id string) error {
+	current, err := this.store.GetLock(ref)
+	if err == store.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current.ID != id {
+		return &LockHeldError{*current}
+	}
+	return nil
+}
+
+// respondWithError responds with the status matching the given error: 423
+// Locked (including the current lock) if the state is locked by someone else,
+// 409 Conflict if the state does not succeed the stored one and 500 for
+// everything else.
+func (this *Backend) respondWithError(w http.ResponseWriter, ref string, message string, err error) {
+	var lhErr *LockHeldError
+	var scErr *StateConflictError
+	switch {
+	case errors.As(err, &lhErr):
+		log.WithError(err).
+			With("ref", ref).
+			Info(message)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusLocked)
+		_ = json.NewEncoder(w).Encode(lhErr.Lock)
+	case errors.As(err, &scErr):
+		log.WithError(err).
+			With("ref", ref).
+			Warn(message)
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.WithError(err).
+			With("ref", ref).
+			Error(message)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// handleUnlockState only removes the lock if it has the ID of the request;
+// otherwise it responds with 423 Locked and the current lock.
+func (this *Backend) handleUnlockState(w http.ResponseWriter, r *http.Request) {
+	ref := this.getRefHook(r)
+
+	var lock types.Lock
+	if err := json.NewDecoder(r.Body).Decode(&lock); err != nil {
+		log.WithError(err).
+			With("ref", ref).
+			Error("Cannot decode body of unlock request.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := this.store.DeleteLockOf(ref, lock.ID); err != nil {
+		this.respondWithError(w, ref, "Cannot release lock.", err)
+		return
+	}
+
+	delete(this.heldLocks, ref)
+	w.WriteHeader(http.StatusOK)
+}
+
+// startLockHeartbeat renews all held locks regularly, so they do not expire
+// while Terraform is still running.
+func (this *Backend) startLockHeartbeat(ttl time.Duration) {
+	done := make(chan struct{})
+	this.heartbeatDone = done
+
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				this.renewHeldLocks()
+			}
+		}
+	}()
+}
+
+func (this *Backend) renewHeldLocks() {
+	this.handleMutex.Lock()
+	defer this.handleMutex.Unlock()
+
+	for ref, lock := range this.heldLocks {
+		l := log.With("ref", ref).
+			With("lockId", lock.ID)
+		if err := this.store.renewLock(ref, lock); errors.Is(err, ErrLockConflict) {
+			l.WithError(err).
+				Error("Lock is not held anymore; it was probably broken by someone else.")
+			delete(this.heldLocks, ref)
+		} else if err != nil {
+			l.WithError(err).
+				Warn("Cannot renew lock; will try again.")
+		} else {
+			l.Debug("Lock renewed.")
+		}
+	}
+}
+
+func (this *Backend) IgnoreStateConflicts() bool {
+	return this.ignoreStateConflicts
+}
+
 func (this *Backend) Close() (rErr error) {
+	if err := this.removeVariablesFile(); err != nil {
+		rErr = err
+	}
+	if v := this.heartbeatDone; v != nil {
+		close(v)
+		this.heartbeatDone = nil
+	}
+	if v := this.serveErr; v != nil {
+		select {
+		case err := <-v:
+			rErr = fmt.Errorf("backend server failed: %w", err)
+		default:
+		}
+		this.serveErr = nil
+	}
+
 	defer func() {
 		this.bitwarden = nil
 	}()
@@ -293,15 +667,35 @@ func (this *Backend) Plugin() *plugin.Plugin {
 }
 
 func (this *Backend) baseAddress() (string, error) {
-	sc := this.config.GetState()
-	bc := this.config.GetBackend()
-	if sc.ItemId != "" {
-		return fmt.Sprintf("http://127.0.0.1:%d/?item=id:%v", bc.GetPort(), url.QueryEscape(sc.ItemId)), nil
-	} else if sc.ItemName != "" {
-		return fmt.Sprintf("http://127.0.0.1:%d/?item=name:%v", bc.GetPort(), url.QueryEscape(sc.ItemName)), nil
-	} else {
-		return "", fmt.Errorf("config.state has to contain either item_id or item_name")
+	ref, err := this.config.GetState().StoreRefOfWorkspace(this.workspace)
+	if err != nil {
+		return "", err
+	}
+	address, err := this.serverAddress()
+	if err != nil {
+		return "", err
+	}
+	item := "name:" + url.QueryEscape(ref.ItemName)
+	if ref.ItemId != "" {
+		item = "id:" + url.QueryEscape(ref.ItemId)
+	}
+	if v := ref.AttachmentPrefix; v != "" {
+		item = "prefix:" + url.QueryEscape(v) + ":" + item
+	}
+	return fmt.Sprintf("%s?item=%s", address, item), nil
+}
+
+// serverAddress returns the address of the server without any state item.
+func (this *Backend) serverAddress() (string, error) {
+	if this.listener == nil {
+		return "", fmt.Errorf("backend not yet initialized")
+	}
+	scheme := "http"
+	if this.certificate != nil {
+		scheme = "https"
 	}
+	// The port might be chosen by the system; so always use the actual one.
+	return fmt.Sprintf("%s://%s/", scheme, this.listener.Addr().String()), nil
 }
 
 func (this *Backend) terraformEnvironment() ([]string, error) {
@@ -324,19 +718,59 @@ func (this *Backend) terraformEnvironment() ([]string, error) {
 		"TF_HTTP_LOCK_ADDRESS":   baseAddress,
 		"TF_HTTP_UNLOCK_ADDRESS": baseAddress,
 		"TF_HTTP_RETRY_MAX":      "0",
+		"TF_HTTP_USERNAME":       this.credentials.username,
+		"TF_HTTP_PASSWORD":       this.credentials.password,
+
+		// The HTTP backend of Terraform does not support workspaces. The
+		// workspace is already reflected by the item of TF_HTTP_ADDRESS.
+		"TF_WORKSPACE": defaultWorkspace,
 	}
 
-	vars, err := this.config.Variables.Resolve(b)
-	if err != nil {
-		return nil, err
+	if v := this.certificate; v != nil {
+		env["TF_HTTP_CLIENT_CA_CERTIFICATE_PEM"] = string(v.pem)
+	}
+
+	tc := this.config.GetTerraform()
+	if tc.Encryption != "" || tc.EncryptionVariable != "" {
+		if tc.GetFlavor() != TerraformFlavorOpenTofu {
+			return nil, fmt.Errorf("terraform: encryption is only supported by flavor %s but %s is used", TerraformFlavorOpenTofu, tc.GetFlavor())
+		}
+		encryption, err := this.resolveEncryption(b)
+		if err != nil {
+			return nil, err
+		}
+		env["TF_ENCRYPTION"] = encryption
 	}
-	for k, v := range vars {
-		env["TF_VAR_"+k] = v
+
+	if err := this.provideTerraformVariables(b, env); err != nil {
+		return nil, err
 	}
 
 	return utils.AddEnvironment(os.Environ(), env), nil
 }
 
+// resolveEncryption returns either the configured encryption or the value of
+// the variable it is referenced by.
+func (this *Backend) resolveEncryption(b *bitwarden.Bitwarden) (string, error) {
+	tc := this.config.GetTerraform()
+	if tc.EncryptionVariable == "" {
+		return tc.Encryption, nil
+	}
+	v, ok := this.config.Variables.Lookup(tc.EncryptionVariable)
+	if !ok {
+		return "", fmt.Errorf("terraform: encryption_variable references unknown variable: '%s'", tc.EncryptionVariable)
+	}
+	value, err := v.Resolve(b, this.config.Variables)
+	if err != nil {
+		return "", err
+	}
+	result, err := encodeEnvironmentValue(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", v.Label, err)
+	}
+	return result, nil
+}
+
 func (this *Backend) GetOrganizationId() string {
 	return this.config.GetState().OrganizationId
 }
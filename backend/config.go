@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/zclconf/go-cty/cty"
 	"os"
 	"path/filepath"
 )
 
+const localConfigFile = ".backend-bitwarden.hcl"
+
 func NewConfig() *Config {
 	return &Config{
 		Variables: NewConfigVariables(),
@@ -51,6 +54,13 @@ func (this Config) Validate() error {
 			return err
 		}
 	}
+	if v := this.GetTerraform().EncryptionVariable; v != "" {
+		if ev, ok := this.Variables.Lookup(v); !ok {
+			return fmt.Errorf("terraform: encryption_variable references unknown variable: '%s'", v)
+		} else if ev.IsAllFields() {
+			return fmt.Errorf("terraform: encryption_variable must not reference a variable with all_fields: '%s'", v)
+		}
+	}
 	return nil
 }
 
@@ -93,7 +103,7 @@ func (this *Config) Read(ctx *hcl.EvalContext) error {
 			"user": user.ToValue(),
 		}),
 	}
-	if err := local.ReadFile(".backend-bitwarden.hcl", childCtx); err != nil && !os.IsNotExist(err) {
+	if err := local.ReadFile(localConfigFile, childCtx); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
@@ -101,6 +111,39 @@ func (this *Config) Read(ctx *hcl.EvalContext) error {
 	return nil
 }
 
+// recordStateItemId adds item_id to the state block inside the local
+// configuration file. item_name is kept, because the items of all other
+// workspaces are named after it. It returns false if the file does not exist
+// or does not configure item_name itself.
+func recordStateItemId(itemId string) (bool, error) {
+	fi, err := os.Stat(localConfigFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	src, err := os.ReadFile(localConfigFile)
+	if err != nil {
+		return false, err
+	}
+	f, diags := hclwrite.ParseConfig(src, localConfigFile, hcl.InitialPos)
+	if diags.HasErrors() {
+		return false, fmt.Errorf("cannot parse configuration file %s: %w", localConfigFile, diags)
+	}
+
+	block := f.Body().FirstMatchingBlock("state", nil)
+	if block == nil || block.Body().GetAttribute("item_name") == nil {
+		return false, nil
+	}
+	block.Body().SetAttributeValue("item_id", cty.StringVal(itemId))
+
+	if err := os.WriteFile(localConfigFile, f.Bytes(), fi.Mode().Perm()); err != nil {
+		return false, fmt.Errorf("cannot write configuration file %s: %w", localConfigFile, err)
+	}
+	return true, nil
+}
+
 func (this Config) Merge(with Config) Config {
 	return Config{
 		Variables: this.Variables.Merge(with.Variables),
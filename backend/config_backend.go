@@ -1,24 +1,71 @@
 package backend
 
 import (
+	"fmt"
 	"github.com/zclconf/go-cty/cty"
+	"strconv"
 )
 
+const defaultBackendPort = 26394
+
+// BackendPort is either a port number or "auto" (same as 0) to let the system
+// choose a free port.
+type BackendPort string
+
+const BackendPortAuto = BackendPort("auto")
+
+func (this BackendPort) Validate() error {
+	_, err := this.parse()
+	return err
+}
+
+func (this BackendPort) parse() (uint16, error) {
+	switch this {
+	case "":
+		return defaultBackendPort, nil
+	case BackendPortAuto:
+		return 0, nil
+	}
+	result, err := strconv.ParseUint(string(this), 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("illegal port: '%s'", string(this))
+	}
+	return uint16(result), nil
+}
+
+func (this *BackendPort) Set(plain string) error {
+	buf := BackendPort(plain)
+	if err := buf.Validate(); err != nil {
+		return err
+	}
+	*this = buf
+	return nil
+}
+
+func (this BackendPort) String() string {
+	return string(this)
+}
+
 func NewConfigBackend() *ConfigBackend {
 	return &ConfigBackend{}
 }
 
 type ConfigBackend struct {
-	Port uint16 `hcl:"port,optional"`
+	Port BackendPort `hcl:"port,optional"`
+	Tls  *bool       `hcl:"tls,optional"`
 }
 
 func (this ConfigBackend) Validate() error {
+	if err := this.Port.Validate(); err != nil {
+		return fmt.Errorf("backend: %w", err)
+	}
 	return nil
 }
 
 func (this ConfigBackend) ToValue() cty.Value {
 	return cty.ObjectVal(map[string]cty.Value{
-		"port": cty.NumberUIntVal(uint64(this.Port)),
+		"port": cty.StringVal(this.Port.String()),
+		"tls":  cty.BoolVal(this.IsTls()),
 	})
 }
 
@@ -31,11 +78,16 @@ func ConfigBackendToValue(v *ConfigBackend) cty.Value {
 
 func (this ConfigBackend) Merge(what ConfigBackend) ConfigBackend {
 	port := this.Port
-	if port == 0 {
+	if port == "" {
 		port = what.Port
 	}
+	tls := this.Tls
+	if tls == nil {
+		tls = what.Tls
+	}
 	return ConfigBackend{
 		Port: port,
+		Tls:  tls,
 	}
 }
 
@@ -53,9 +105,18 @@ func MergeConfigBackend(a, b *ConfigBackend) *ConfigBackend {
 	return nil
 }
 
+// GetPort returns the port the backend should listen on. 0 means that the
+// system should choose a free port.
 func (this ConfigBackend) GetPort() uint16 {
-	if v := this.Port; v > 0 {
-		return v
+	result, _ := this.Port.parse()
+	return result
+}
+
+// IsTls returns true if the backend should only be reachable via TLS using a
+// self-signed certificate generated for each run. Requires Terraform 1.6+.
+func (this ConfigBackend) IsTls() bool {
+	if v := this.Tls; v != nil {
+		return *v
 	}
-	return 26394
+	return false
 }
@@ -6,20 +6,50 @@ import (
 	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
 	"github.com/hashicorp/go-uuid"
 	"github.com/zclconf/go-cty/cty"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func NewConfigState() *ConfigState {
 	return &ConfigState{}
 }
 
+type StateStorage string
+
+const (
+	StateStorageAttachment = StateStorage("attachment")
+	StateStorageNotes      = StateStorage("notes")
+)
+
 type ConfigState struct {
-	MaxRevisions uint16 `hcl:"max_revisions,optional"`
+	MaxRevisions uint16           `hcl:"max_revisions,optional"`
+	Storage      StateStorage     `hcl:"storage,optional"`
+	Compression  StateCompression `hcl:"compression,optional"`
+	ChunkSize    *int64           `hcl:"chunk_size,optional"`
+
+	MaxAge     string `hcl:"max_age,optional"`
+	KeepHourly uint16 `hcl:"keep_hourly,optional"`
+	KeepDaily  uint16 `hcl:"keep_daily,optional"`
+	KeepWeekly uint16 `hcl:"keep_weekly,optional"`
+
+	LockTtl string `hcl:"lock_ttl,optional"`
 
 	ItemId         string `hcl:"item_id,optional"`
 	OrganizationId string `hcl:"organization_id,optional"`
 	CollectionId   string `hcl:"collection_id,optional"`
 	FolderId       string `hcl:"folder_id,optional"`
 	ItemName       string `hcl:"item_name,optional"`
+
+	CreateIfMissing *bool  `hcl:"create_if_missing,optional"`
+	FolderName      string `hcl:"folder_name,optional"`
+	CollectionName  string `hcl:"collection_name,optional"`
+	RecordItemId    *bool  `hcl:"record_item_id,optional"`
+
+	AmbiguityPolicy bitwarden.AmbiguityPolicy `hcl:"ambiguity_policy,optional"`
+
+	WorkspaceItemName         string `hcl:"workspace_item_name,optional"`
+	WorkspaceAttachmentPrefix string `hcl:"workspace_attachment_prefix,optional"`
 }
 
 func (this ConfigState) Validate() error {
@@ -36,11 +66,53 @@ func (this ConfigState) Validate() error {
 		return fmt.Errorf("state: illegal folder_id: '%s'", this.FolderId)
 	}
 
-	if this.ItemName != "" && this.ItemId != "" {
-		return fmt.Errorf("state: attribute name and item_id cannot be used together")
+	if err := this.AmbiguityPolicy.Validate(); err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+
+	switch this.Storage {
+	case "", StateStorageAttachment, StateStorageNotes:
+	default:
+		return fmt.Errorf("state: illegal storage: '%s'", this.Storage)
+	}
+	if err := this.Compression.Validate(); err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	if v := this.ChunkSize; v != nil && *v <= 0 {
+		return fmt.Errorf("state: chunk_size has to be greater than 0: %d", *v)
+	}
+	if _, err := ParseDuration(this.MaxAge); err != nil {
+		return fmt.Errorf("state: max_age: %w", err)
+	}
+	if _, err := ParseDuration(this.LockTtl); err != nil {
+		return fmt.Errorf("state: lock_ttl: %w", err)
+	}
+	if v := this.WorkspaceItemName; v != "" && !strings.Contains(v, workspacePlaceholder) {
+		return fmt.Errorf("state: workspace_item_name has to contain %s: '%s'", workspacePlaceholder, v)
+	}
+	if v := this.WorkspaceAttachmentPrefix; v != "" {
+		if !strings.Contains(v, workspacePlaceholder) {
+			return fmt.Errorf("state: workspace_attachment_prefix has to contain %s: '%s'", workspacePlaceholder, v)
+		}
+		if !workspaceNameRegex.MatchString(strings.ReplaceAll(v, workspacePlaceholder, defaultWorkspace)) {
+			return fmt.Errorf("state: workspace_attachment_prefix can only contain letters, digits, _, . and - besides of %s: '%s'", workspacePlaceholder, v)
+		}
+		if this.WorkspaceItemName != "" {
+			return fmt.Errorf("state: attribute workspace_attachment_prefix and workspace_item_name cannot be used together")
+		}
+		if this.Storage == StateStorageNotes {
+			return fmt.Errorf("state: attribute workspace_attachment_prefix cannot be used with storage %s", StateStorageNotes)
+		}
+	}
+
+	if this.FolderName != "" && this.FolderId != "" {
+		return fmt.Errorf("state: attribute folder_name and folder_id cannot be used together")
+	}
+	if this.CollectionName != "" && this.CollectionId != "" {
+		return fmt.Errorf("state: attribute collection_name and collection_id cannot be used together")
 	}
-	if this.ItemName == "" && this.ItemId == "" {
-		return fmt.Errorf("state: one attribute of item_name or item_id ref is required")
+	if this.CollectionName != "" && this.OrganizationId == "" {
+		return fmt.Errorf("state: attribute collection_name requires organization_id")
 	}
 
 	return nil
@@ -52,6 +124,7 @@ func (this ConfigState) toItemQuery() bitwarden.ItemQuery {
 		OrganizationId: this.OrganizationId,
 		CollectionId:   this.CollectionId,
 		FolderId:       this.FolderId,
+		OnAmbiguity:    this.AmbiguityPolicy,
 		OnTooBroadQuery: func() {
 			log.With("itemName", this.ItemName).
 				Warn("It is strongly recommend to provide at least one limitation of: organization_id, collection_id, folder_id. Otherwise too many items might be returned.")
@@ -62,12 +135,32 @@ func (this ConfigState) toItemQuery() bitwarden.ItemQuery {
 func (this ConfigState) ToValue() cty.Value {
 	return cty.ObjectVal(map[string]cty.Value{
 		"max_revisions": cty.NumberUIntVal(uint64(this.MaxRevisions)),
+		"storage":       cty.StringVal(string(this.GetStorage())),
+		"compression":   cty.StringVal(string(this.GetCompression())),
+		"chunk_size":    cty.NumberIntVal(this.GetChunkSize()),
+
+		"max_age":     cty.StringVal(this.MaxAge),
+		"keep_hourly": cty.NumberUIntVal(uint64(this.KeepHourly)),
+		"keep_daily":  cty.NumberUIntVal(uint64(this.KeepDaily)),
+		"keep_weekly": cty.NumberUIntVal(uint64(this.KeepWeekly)),
+
+		"lock_ttl": cty.StringVal(this.LockTtl),
 
 		"item_id":         cty.StringVal(this.ItemId),
 		"organization_id": cty.StringVal(this.OrganizationId),
 		"collection_id":   cty.StringVal(this.CollectionId),
 		"folder_id":       cty.StringVal(this.FolderId),
 		"item_name":       cty.StringVal(this.ItemName),
+
+		"create_if_missing": cty.BoolVal(this.IsCreateIfMissing()),
+		"folder_name":       cty.StringVal(this.FolderName),
+		"collection_name":   cty.StringVal(this.CollectionName),
+		"record_item_id":    cty.BoolVal(this.IsRecordItemId()),
+
+		"ambiguity_policy": cty.StringVal(this.AmbiguityPolicy.String()),
+
+		"workspace_item_name":         cty.StringVal(this.GetWorkspaceItemName()),
+		"workspace_attachment_prefix": cty.StringVal(this.WorkspaceAttachmentPrefix),
 	})
 }
 
@@ -83,6 +176,38 @@ func (this ConfigState) Merge(with ConfigState) ConfigState {
 	if maxRevisions == 0 {
 		maxRevisions = with.MaxRevisions
 	}
+	storage := this.Storage
+	if storage == "" {
+		storage = with.Storage
+	}
+	compression := this.Compression
+	if compression == "" {
+		compression = with.Compression
+	}
+	chunkSize := this.ChunkSize
+	if chunkSize == nil {
+		chunkSize = with.ChunkSize
+	}
+	maxAge := this.MaxAge
+	if maxAge == "" {
+		maxAge = with.MaxAge
+	}
+	keepHourly := this.KeepHourly
+	if keepHourly == 0 {
+		keepHourly = with.KeepHourly
+	}
+	keepDaily := this.KeepDaily
+	if keepDaily == 0 {
+		keepDaily = with.KeepDaily
+	}
+	keepWeekly := this.KeepWeekly
+	if keepWeekly == 0 {
+		keepWeekly = with.KeepWeekly
+	}
+	lockTtl := this.LockTtl
+	if lockTtl == "" {
+		lockTtl = with.LockTtl
+	}
 	itemId := this.ItemId
 	if itemId == "" {
 		itemId = with.ItemId
@@ -103,13 +228,59 @@ func (this ConfigState) Merge(with ConfigState) ConfigState {
 	if itemName == "" {
 		itemName = with.ItemName
 	}
+	createIfMissing := this.CreateIfMissing
+	if createIfMissing == nil {
+		createIfMissing = with.CreateIfMissing
+	}
+	folderName := this.FolderName
+	if folderName == "" {
+		folderName = with.FolderName
+	}
+	collectionName := this.CollectionName
+	if collectionName == "" {
+		collectionName = with.CollectionName
+	}
+	recordItemId := this.RecordItemId
+	if recordItemId == nil {
+		recordItemId = with.RecordItemId
+	}
+	ambiguityPolicy := this.AmbiguityPolicy
+	if ambiguityPolicy == "" {
+		ambiguityPolicy = with.AmbiguityPolicy
+	}
+	workspaceItemName := this.WorkspaceItemName
+	if workspaceItemName == "" {
+		workspaceItemName = with.WorkspaceItemName
+	}
+	workspaceAttachmentPrefix := this.WorkspaceAttachmentPrefix
+	if workspaceAttachmentPrefix == "" {
+		workspaceAttachmentPrefix = with.WorkspaceAttachmentPrefix
+	}
 	return ConfigState{
 		MaxRevisions:   maxRevisions,
+		Storage:        storage,
+		Compression:    compression,
+		ChunkSize:      chunkSize,
+		MaxAge:         maxAge,
+		KeepHourly:     keepHourly,
+		KeepDaily:      keepDaily,
+		KeepWeekly:     keepWeekly,
+		LockTtl:        lockTtl,
 		ItemId:         itemId,
 		OrganizationId: organizationId,
 		CollectionId:   collectionId,
 		FolderId:       folderId,
 		ItemName:       itemName,
+
+		CreateIfMissing: createIfMissing,
+		FolderName:      folderName,
+		CollectionName:  collectionName,
+		RecordItemId:    recordItemId,
+
+		AmbiguityPolicy: ambiguityPolicy,
+
+		WorkspaceItemName:         workspaceItemName,
+		WorkspaceAttachmentPrefix: workspaceAttachmentPrefix,
 	}
 }
 
@@ -133,3 +304,96 @@ func (this ConfigState) GetMaxRevisions() uint16 {
 	}
 	return 2
 }
+
+// GetRetentionPolicy returns the policy which decides which revisions are
+// kept. MaxAge is assumed to be already validated.
+func (this ConfigState) GetRetentionPolicy() RetentionPolicy {
+	maxAge, _ := ParseDuration(this.MaxAge)
+	return RetentionPolicy{
+		MaxRevisions: this.GetMaxRevisions(),
+		MaxAge:       maxAge,
+		KeepHourly:   this.KeepHourly,
+		KeepDaily:    this.KeepDaily,
+		KeepWeekly:   this.KeepWeekly,
+	}
+}
+
+func (this ConfigState) IsCreateIfMissing() bool {
+	if v := this.CreateIfMissing; v != nil {
+		return *v
+	}
+	return false
+}
+
+func (this ConfigState) IsRecordItemId() bool {
+	if v := this.RecordItemId; v != nil {
+		return *v
+	}
+	return false
+}
+
+// GetLockTtl returns the duration after which a lock without heartbeat of its
+// holder is considered as expired. 0 means locks never expire.
+func (this ConfigState) GetLockTtl() time.Duration {
+	result, _ := ParseDuration(this.LockTtl)
+	return result
+}
+
+func (this ConfigState) GetStorage() StateStorage {
+	if v := this.Storage; v != "" {
+		return v
+	}
+	return StateStorageAttachment
+}
+
+func (this ConfigState) GetCompression() StateCompression {
+	if v := this.Compression; v != "" {
+		return v
+	}
+	return StateCompressionNone
+}
+
+// GetChunkSize returns the maximum size of one attachment of a state. 0 means
+// states are never split.
+func (this ConfigState) GetChunkSize() int64 {
+	if v := this.ChunkSize; v != nil {
+		return *v
+	}
+	return 0
+}
+
+func (this ConfigState) GetWorkspaceItemName() string {
+	if v := this.WorkspaceItemName; v != "" {
+		return v
+	}
+	return itemNamePlaceholder + "-" + workspacePlaceholder
+}
+
+// ParseDuration parses durations like time.ParseDuration does but also
+// supports days (d) and weeks (w) as units, like "30d" or "2w".
+func ParseDuration(plain string) (time.Duration, error) {
+	plain = strings.TrimSpace(plain)
+	if plain == "" {
+		return 0, nil
+	}
+	for suffix, unit := range map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	} {
+		if strings.HasSuffix(plain, suffix) {
+			v, err := strconv.ParseUint(strings.TrimSuffix(plain, suffix), 10, 32)
+			if err != nil {
+				return 0, fmt.Errorf("illegal duration: '%s'", plain)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	result, err := time.ParseDuration(plain)
+	if err != nil {
+		return 0, fmt.Errorf("illegal duration: '%s'", plain)
+	}
+	if result < 0 {
+		return 0, fmt.Errorf("illegal duration: '%s'", plain)
+	}
+	return result, nil
+}
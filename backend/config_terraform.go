@@ -1,25 +1,99 @@
 package backend
 
 import (
+	"fmt"
 	"github.com/echocat/terraform-provider-bitwarden/utils"
 	"github.com/zclconf/go-cty/cty"
+	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
+// TerraformFlavor is the distribution of Terraform which is wrapped.
+type TerraformFlavor string
+
+const (
+	TerraformFlavorTerraform = TerraformFlavor("terraform")
+	TerraformFlavorOpenTofu  = TerraformFlavor("opentofu")
+)
+
+func (this TerraformFlavor) Validate() error {
+	switch this {
+	case "", TerraformFlavorTerraform, TerraformFlavorOpenTofu:
+		return nil
+	default:
+		return fmt.Errorf("illegal flavor: '%s'", string(this))
+	}
+}
+
+func (this *TerraformFlavor) Set(plain string) error {
+	buf := TerraformFlavor(plain)
+	if err := buf.Validate(); err != nil {
+		return err
+	}
+	*this = buf
+	return nil
+}
+
+func (this TerraformFlavor) String() string {
+	return string(this)
+}
+
+func (this TerraformFlavor) defaultExecutable() utils.Executable {
+	switch this {
+	case TerraformFlavorOpenTofu:
+		return "tofu"
+	default:
+		return "terraform"
+	}
+}
+
 func NewConfigTerraform() *ConfigTerraform {
 	return &ConfigTerraform{}
 }
 
 type ConfigTerraform struct {
 	Executable utils.Executable `hcl:"executable,optional"`
+	Flavor     TerraformFlavor  `hcl:"flavor,optional"`
+
+	// Encryption is passed as TF_ENCRYPTION to OpenTofu to encrypt the state
+	// on client side. As it is stored in plain text, it should not contain
+	// any keys; use EncryptionVariable instead.
+	Encryption string `hcl:"encryption,optional"`
+
+	// EncryptionVariable is the label of a variable block which value is
+	// passed as TF_ENCRYPTION instead of Encryption. This way the whole
+	// configuration including its keys can be stored in Bitwarden. The
+	// variable itself is not passed to Terraform.
+	EncryptionVariable string `hcl:"encryption_variable,optional"`
+
+	VariablesMode TerraformVariablesMode `hcl:"variables,optional"`
 }
 
 func (this ConfigTerraform) Validate() error {
+	if err := this.Flavor.Validate(); err != nil {
+		return fmt.Errorf("terraform: %w", err)
+	}
+	if err := this.VariablesMode.Validate(); err != nil {
+		return fmt.Errorf("terraform: %w", err)
+	}
+	if this.Encryption != "" && this.EncryptionVariable != "" {
+		return fmt.Errorf("terraform: attribute encryption and encryption_variable cannot be used together")
+	}
+	if (this.Encryption != "" || this.EncryptionVariable != "") && this.Flavor == TerraformFlavorTerraform {
+		return fmt.Errorf("terraform: encryption is only supported by flavor %s", TerraformFlavorOpenTofu)
+	}
 	return nil
 }
 
 func (this ConfigTerraform) ToValue() cty.Value {
 	return cty.ObjectVal(map[string]cty.Value{
 		"executable": cty.StringVal(this.Executable.String()),
+		"flavor":     cty.StringVal(this.Flavor.String()),
+		"encryption": cty.StringVal(this.Encryption),
+		"variables":  cty.StringVal(this.VariablesMode.String()),
+
+		"encryption_variable": cty.StringVal(this.EncryptionVariable),
 	})
 }
 
@@ -35,8 +109,28 @@ func (this ConfigTerraform) Merge(what ConfigTerraform) ConfigTerraform {
 	if executable == "" {
 		executable = what.Executable
 	}
+	flavor := this.Flavor
+	if flavor == "" {
+		flavor = what.Flavor
+	}
+	encryption := this.Encryption
+	if encryption == "" {
+		encryption = what.Encryption
+	}
+	encryptionVariable := this.EncryptionVariable
+	if encryptionVariable == "" {
+		encryptionVariable = what.EncryptionVariable
+	}
+	variablesMode := this.VariablesMode
+	if variablesMode == "" {
+		variablesMode = what.VariablesMode
+	}
 	return ConfigTerraform{
-		Executable: executable,
+		Executable:         executable,
+		Flavor:             flavor,
+		Encryption:         encryption,
+		EncryptionVariable: encryptionVariable,
+		VariablesMode:      variablesMode,
 	}
 }
 
@@ -54,9 +148,41 @@ func MergeConfigTerraform(a, b *ConfigTerraform) *ConfigTerraform {
 	return nil
 }
 
+// GetExecutable returns the configured executable. If absent it is derived
+// from the flavor; without flavor tofu is used if terraform cannot be found.
+// As this requires to search the PATH, the result is stored as Executable
+// while the configuration is initialized.
 func (this ConfigTerraform) GetExecutable() utils.Executable {
 	if v := this.Executable; v != "" {
 		return v
 	}
-	return "terraform"
+	if v := this.Flavor; v != "" {
+		return v.defaultExecutable()
+	}
+	if _, err := exec.LookPath(TerraformFlavorTerraform.defaultExecutable().String()); err != nil {
+		if _, err := exec.LookPath(TerraformFlavorOpenTofu.defaultExecutable().String()); err == nil {
+			return TerraformFlavorOpenTofu.defaultExecutable()
+		}
+	}
+	return TerraformFlavorTerraform.defaultExecutable()
+}
+
+// GetFlavor returns the configured flavor. If absent it is derived from the
+// name of the executable.
+func (this ConfigTerraform) GetFlavor() TerraformFlavor {
+	if v := this.Flavor; v != "" {
+		return v
+	}
+	name := strings.ToLower(filepath.Base(this.GetExecutable().String()))
+	if strings.HasPrefix(name, TerraformFlavorOpenTofu.defaultExecutable().String()) {
+		return TerraformFlavorOpenTofu
+	}
+	return TerraformFlavorTerraform
+}
+
+func (this ConfigTerraform) GetVariablesMode() TerraformVariablesMode {
+	if v := this.VariablesMode; v != "" {
+		return v
+	}
+	return TerraformVariablesModeEnvironment
 }
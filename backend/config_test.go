@@ -0,0 +1,47 @@
+package backend
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRecordStateItemId_keepsItemName(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(localConfigFile, []byte("state {\n  item_name = \"terraform-state\"\n}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := recordStateItemId("0b7b1c6e-0000-0000-0000-000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected item_id to be recorded")
+	}
+
+	actual, err := os.ReadFile(localConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`item_name = "terraform-state"`, `item_id   = "0b7b1c6e-0000-0000-0000-000000000000"`} {
+		if !strings.Contains(string(actual), expected) {
+			t.Errorf("expected %q in:\n%s", expected, actual)
+		}
+	}
+
+	var config Config
+	if err := config.ReadFile(localConfigFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.GetState().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := config.GetState().StoreRefOfWorkspace("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.ItemName != "terraform-state-other" {
+		t.Errorf("expected item of workspace other to be still named after item_name but got %v", ref)
+	}
+}
@@ -1,18 +1,30 @@
 package backend
 
 import (
+	"errors"
 	"fmt"
 	log "github.com/echocat/slf4g"
 	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
 	"github.com/hashicorp/go-uuid"
 	"github.com/zclconf/go-cty/cty"
 	"regexp"
+	"strings"
 )
 
 var (
 	varNameRegex = regexp.MustCompile("^[a-z_]+$")
+	envNameRegex = regexp.MustCompile("^[A-Z_][A-Z0-9_]*$")
+
+	// fieldVarNameRegex matches the names of variables provided by
+	// all_fields; other than labels they might contain digits.
+	fieldVarNameRegex = regexp.MustCompile("^[a-z_][a-z0-9_]*$")
+
+	prefixRegex             = regexp.MustCompile("^[a-z_][a-z0-9_]*$")
+	illegalFieldNameCharsRe = regexp.MustCompile("[^a-z0-9_]+")
 )
 
+const terraformVariableEnvPrefix = "TF_VAR_"
+
 type ConfigVariable struct {
 	Label string `hcl:"label,label"`
 
@@ -23,7 +35,28 @@ type ConfigVariable struct {
 	Name           string `hcl:"name,optional"`
 	Field          string `hcl:"field,optional"`
 
+	// Attachment is the file name of an attachment of the item which content
+	// is used as value.
+	Attachment string `hcl:"attachment,optional"`
+
+	// AllFields exports every custom field of the item as separate variable
+	// named <Prefix><field name>.
+	AllFields *bool  `hcl:"all_fields,optional"`
+	Prefix    string `hcl:"prefix,optional"`
+
+	AmbiguityPolicy bitwarden.AmbiguityPolicy `hcl:"ambiguity_policy,optional"`
+
 	Ref string `hcl:"ref,optional"`
+
+	// Env is the name of the environment variable which holds the value
+	// while using the exec command. If absent the upper case label is used.
+	// In combination with AllFields it is the prefix of all names; if
+	// absent the upper case Prefix is used.
+	Env string `hcl:"env,optional"`
+
+	// Type defines how the value is converted (see VariableType); string if
+	// absent.
+	Type VariableType `hcl:"type,optional"`
 }
 
 func (this ConfigVariable) Validate() error {
@@ -46,10 +79,36 @@ func (this ConfigVariable) Validate() error {
 	if _, err := uuid.ParseUUID(this.FolderId); this.FolderId != "" && err != nil {
 		return fmt.Errorf("%s: illegal folder_id: '%s'", this.Label, this.FolderId)
 	}
+	if err := this.AmbiguityPolicy.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", this.Label, err)
+	}
 	if this.Ref != "" && !varNameRegex.MatchString(this.Ref) {
 		return fmt.Errorf("%s: illegal ref: '%s'", this.Label, this.Ref)
 	}
 
+	if err := this.Type.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", this.Label, err)
+	}
+	if this.Env != "" && !envNameRegex.MatchString(this.Env) {
+		return fmt.Errorf("%s: illegal env: '%s'", this.Label, this.Env)
+	}
+	if strings.HasPrefix(this.Env, terraformVariableEnvPrefix) {
+		return fmt.Errorf("%s: env must not start with %s: '%s'", this.Label, terraformVariableEnvPrefix, this.Env)
+	}
+
+	if this.Prefix != "" && !prefixRegex.MatchString(this.Prefix) {
+		return fmt.Errorf("%s: illegal prefix: '%s'", this.Label, this.Prefix)
+	}
+	if this.Prefix != "" && !this.IsAllFields() {
+		return fmt.Errorf("%s: attribute prefix requires all_fields", this.Label)
+	}
+	if this.IsAllFields() && (this.Field != "" || this.Attachment != "" || this.Ref != "") {
+		return fmt.Errorf("%s: attribute all_fields cannot be used together with field, attachment or ref", this.Label)
+	}
+	if this.Attachment != "" && this.Field != "" {
+		return fmt.Errorf("%s: attribute attachment and field cannot be used together", this.Label)
+	}
+
 	if this.Name != "" && this.ItemId != "" && this.Ref != "" {
 		return fmt.Errorf("%s: attribute name, item_id and ref cannot be used together", this.Label)
 	}
@@ -69,13 +128,39 @@ func (this ConfigVariable) ToValue() (string, cty.Value) {
 		"name":            cty.StringVal(this.Name),
 		"field":           cty.StringVal(this.Field),
 		"ref":             cty.StringVal(this.Ref),
+		"env":             cty.StringVal(this.Env),
+		"type":            cty.StringVal(this.Type.String()),
+		"attachment":      cty.StringVal(this.Attachment),
+		"all_fields":      cty.BoolVal(this.IsAllFields()),
+		"prefix":          cty.StringVal(this.Prefix),
+
+		"ambiguity_policy": cty.StringVal(this.AmbiguityPolicy.String()),
 	})
 }
 
-func (this ConfigVariable) Resolve(using *bitwarden.Bitwarden, refs ConfigVariables) (string, error) {
-	result, err := this.resolve(using, refs)
+func (this ConfigVariable) IsAllFields() bool {
+	if v := this.AllFields; v != nil {
+		return *v
+	}
+	return false
+}
+
+func (this ConfigVariable) GetEnv() string {
+	if v := this.Env; v != "" {
+		return v
+	}
+	return strings.ToUpper(this.Label)
+}
+
+// Resolve returns the value of this variable converted to its Type.
+func (this ConfigVariable) Resolve(using *bitwarden.Bitwarden, refs ConfigVariables) (interface{}, error) {
+	plain, err := this.resolve(using, refs)
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", this.Label, err)
+		return nil, fmt.Errorf("%s: %w", this.Label, err)
+	}
+	result, err := this.Type.coerce(plain)
+	if err != nil {
+		return nil, fmt.Errorf("%s: cannot convert value to type %s: %w", this.Label, this.Type, err)
 	}
 	return result, nil
 }
@@ -89,14 +174,24 @@ func (this ConfigVariable) resolve(using *bitwarden.Bitwarden, refs ConfigVariab
 		return refVar.resolve(using, refs)
 	}
 
-	var item *bitwarden.Item
-	if this.ItemId != "" {
-		if item, err = using.GetItem(this.ItemId, nil); err != nil {
-			return "", fmt.Errorf("%s: %w", this.Label, err)
-		}
-	} else {
-		if item, err = using.FindItem(this.toItemQuery()); err != nil {
-			return "", fmt.Errorf("%s: %w", this.Label, err)
+	if this.IsAllFields() {
+		return "", fmt.Errorf("variables with all_fields cannot be resolved as single value")
+	}
+
+	item, err := this.item(using)
+	if err != nil {
+		return "", err
+	}
+
+	if v := this.Attachment; v != "" {
+		return this.resolveAttachment(using, item, v)
+	}
+
+	// A custom field named like the notes keyword wins; otherwise adding the
+	// keyword would have silently changed what such variables resolve to.
+	if this.Field == "notes" {
+		if v, ok := item.Fields.Lookup(this.Field); ok {
+			return v.Value, nil
 		}
 	}
 
@@ -127,6 +222,8 @@ func (this ConfigVariable) resolve(using *bitwarden.Bitwarden, refs ConfigVariab
 			return "", nil
 		}
 		return item.CollectionIds[0], nil
+	case "notes":
+		return item.Notes, nil
 	case "name":
 		return item.Name, nil
 	case "id":
@@ -141,12 +238,87 @@ func (this ConfigVariable) resolve(using *bitwarden.Bitwarden, refs ConfigVariab
 	}
 }
 
+func (this ConfigVariable) item(using *bitwarden.Bitwarden) (result *bitwarden.Item, err error) {
+	if this.ItemId != "" {
+		if result, err = using.GetItem(this.ItemId, nil); err != nil {
+			return nil, fmt.Errorf("%s: %w", this.Label, err)
+		}
+	} else {
+		if result, err = using.FindItem(this.toItemQuery()); err != nil {
+			return nil, fmt.Errorf("%s: %w", this.Label, err)
+		}
+	}
+	return result, nil
+}
+
+func (this ConfigVariable) resolveAttachment(using *bitwarden.Bitwarden, item *bitwarden.Item, fileName string) (string, error) {
+	var candidates bitwarden.ItemAttachmentReferences
+	for _, ref := range item.AttachmentReferences {
+		if ref.FileName == fileName {
+			candidates = append(candidates, ref)
+		}
+	}
+	ref, err := bitwarden.ResolveAttachment(candidates)
+	if errors.Is(err, bitwarden.ErrNoSuchAttachment) {
+		return "", fmt.Errorf("item %v (%v) does not contain attachment %s", item.Name, item.Id, fileName)
+	}
+	if err != nil {
+		return "", fmt.Errorf("attachment %s of item %v (%v): %w", fileName, item.Name, item.Id, err)
+	}
+	return using.GetAttachment(*item, ref.Id, false)
+}
+
+// resolvedVariable is one value provided by a ConfigVariable.
+type resolvedVariable struct {
+	name  string
+	env   string
+	value interface{}
+}
+
+// resolveAll returns all values provided by this variable: the value itself
+// or every custom field of the item if AllFields is set.
+func (this ConfigVariable) resolveAll(using *bitwarden.Bitwarden, refs ConfigVariables) ([]resolvedVariable, error) {
+	if !this.IsAllFields() {
+		value, err := this.Resolve(using, refs)
+		if err != nil {
+			return nil, err
+		}
+		return []resolvedVariable{{this.Label, this.GetEnv(), value}}, nil
+	}
+
+	item, err := this.item(using)
+	if err != nil {
+		return nil, err
+	}
+	envPrefix := this.Env
+	if envPrefix == "" {
+		envPrefix = strings.ToUpper(this.Prefix)
+	}
+	result := make([]resolvedVariable, len(item.Fields))
+	for i, field := range item.Fields {
+		name := illegalFieldNameCharsRe.ReplaceAllString(strings.ToLower(field.Name), "_")
+		// Names like "1st key" are still no valid names after replacing the
+		// illegal characters; only a prefix can make them valid.
+		varName, env := this.Prefix+name, envPrefix+strings.ToUpper(name)
+		if name == "" || !fieldVarNameRegex.MatchString(varName) || !envNameRegex.MatchString(env) {
+			return nil, fmt.Errorf("%s: field '%s' results in the illegal variable name '%s' (env '%s'); use prefix or env to make it valid", this.Label, field.Name, varName, env)
+		}
+		value, err := this.Type.coerce(field.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: cannot convert value of field %s to type %s: %w", this.Label, field.Name, this.Type, err)
+		}
+		result[i] = resolvedVariable{varName, env, value}
+	}
+	return result, nil
+}
+
 func (this ConfigVariable) toItemQuery() bitwarden.ItemQuery {
 	return bitwarden.ItemQuery{
 		Name:           this.Name,
 		OrganizationId: this.OrganizationId,
 		CollectionId:   this.CollectionId,
 		FolderId:       this.FolderId,
+		OnAmbiguity:    this.AmbiguityPolicy,
 		OnTooBroadQuery: func() {
 			log.With("variable", this.Label).
 				With("itemName", this.Name).
@@ -162,10 +334,18 @@ func NewConfigVariables() ConfigVariables {
 type ConfigVariables []ConfigVariable
 
 func (this ConfigVariables) Validate() error {
+	envs := make(map[string]string, len(this))
 	for _, v := range this {
 		if err := v.Validate(); err != nil {
 			return err
 		}
+		if v.IsAllFields() {
+			continue
+		}
+		if other, ok := envs[v.GetEnv()]; ok {
+			return fmt.Errorf("%s: env %s is already used by %s", v.Label, v.GetEnv(), other)
+		}
+		envs[v.GetEnv()] = v.Label
 	}
 	return nil
 }
@@ -199,14 +379,55 @@ func (this ConfigVariables) Merge(with ConfigVariables) ConfigVariables {
 	return result[:i]
 }
 
-func (this ConfigVariables) Resolve(using *bitwarden.Bitwarden) (map[string]string, error) {
-	result := make(map[string]string, len(this))
+func (this ConfigVariables) Resolve(using *bitwarden.Bitwarden) (map[string]interface{}, error) {
+	vars, err := this.resolveAll(using)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{}, len(vars))
+	for _, v := range vars {
+		result[v.name] = v.value
+	}
+	return result, nil
+}
+
+// ResolveEnvironment resolves all variables and returns them by the name of
+// their environment variable (see ConfigVariable.GetEnv).
+func (this ConfigVariables) ResolveEnvironment(using *bitwarden.Bitwarden) (map[string]string, error) {
+	vars, err := this.resolveAll(using)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(vars))
+	for _, v := range vars {
+		ev, err := encodeEnvironmentValue(v.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", v.name, err)
+		}
+		result[v.env] = ev
+	}
+	return result, nil
+}
+
+func (this ConfigVariables) resolveAll(using *bitwarden.Bitwarden) ([]resolvedVariable, error) {
+	var result []resolvedVariable
+	names := map[string]struct{}{}
+	envs := map[string]struct{}{}
 	for _, v := range this {
-		nv, err := v.Resolve(using, this)
+		rvs, err := v.resolveAll(using, this)
 		if err != nil {
 			return nil, err
 		}
-		result[v.Label] = nv
+		for _, rv := range rvs {
+			if _, ok := names[rv.name]; ok {
+				return nil, fmt.Errorf("%s: variable %s is provided more than once", v.Label, rv.name)
+			}
+			if _, ok := envs[rv.env]; ok {
+				return nil, fmt.Errorf("%s: environment variable %s is provided more than once", v.Label, rv.env)
+			}
+			names[rv.name], envs[rv.env] = struct{}{}, struct{}{}
+			result = append(result, rv)
+		}
 	}
 	return result, nil
 }
@@ -0,0 +1,56 @@
+package backend
+
+import (
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigVariable_resolveAll_allFields(t *testing.T) {
+	allFields := true
+	cases := []struct {
+		name     string
+		variable ConfigVariable
+		fields   bitwarden.ItemFields
+		expected []resolvedVariable
+		err      string
+	}{
+		{"plain names", ConfigVariable{}, bitwarden.ItemFields{{Name: "user", Value: "a"}, {Name: "Token_2", Value: "b"}}, []resolvedVariable{{"user", "USER", "a"}, {"token_2", "TOKEN_2", "b"}}, ""},
+		{"illegal characters", ConfigVariable{}, bitwarden.ItemFields{{Name: "a-b", Value: "a"}, {Name: "api key", Value: "b"}}, []resolvedVariable{{"a_b", "A_B", "a"}, {"api_key", "API_KEY", "b"}}, ""},
+		{"prefix", ConfigVariable{Prefix: "db_"}, bitwarden.ItemFields{{Name: "1st key", Value: "a"}}, []resolvedVariable{{"db_1st_key", "DB_1ST_KEY", "a"}}, ""},
+		{"prefix and env", ConfigVariable{Prefix: "db_", Env: "DATABASE_"}, bitwarden.ItemFields{{Name: "1st", Value: "a"}}, []resolvedVariable{{"db_1st", "DATABASE_1ST", "a"}}, ""},
+		{"leading digit", ConfigVariable{}, bitwarden.ItemFields{{Name: "1st key", Value: "a"}}, nil, "field '1st key' results in the illegal variable name '1st_key' (env '1ST_KEY')"},
+		{"leading digit with env only", ConfigVariable{Env: "DB_"}, bitwarden.ItemFields{{Name: "1st", Value: "a"}}, nil, "field '1st' results in the illegal variable name '1st' (env 'DB_1ST')"},
+		{"empty name", ConfigVariable{Prefix: "db_"}, bitwarden.ItemFields{{Name: "", Value: "a"}}, nil, "field '' results in the illegal variable name 'db_'"},
+		{"illegal type", ConfigVariable{Type: VariableTypeNumber}, bitwarden.ItemFields{{Name: "port", Value: "a"}}, nil, "cannot convert value of field port to type number"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newFakeVaultClients(t, ConfigState{}, 1)[0]
+			sb, _ := s.Bitwarden()
+			if _, err := sb.CreateItem(bitwarden.Item{Type: bitwarden.ItemTypeLogin, Name: "db", Fields: c.fields}); err != nil {
+				t.Fatal(err)
+			}
+
+			v := c.variable
+			v.Label, v.Name, v.AllFields = "db", "db", &allFields
+			if err := v.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			actual, err := v.resolveAll(sb, nil)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected error containing %q but got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("expected %+v but got %+v", c.expected, actual)
+			}
+		})
+	}
+}
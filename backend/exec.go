@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"github.com/echocat/terraform-provider-bitwarden/utils"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+	"os/exec"
+)
+
+type execCommand struct {
+	*Backend
+
+	args []string
+}
+
+func (this *execCommand) register(app *kingpin.Application) {
+	cmd := app.Command("exec", "Executes the given command with all variables as environment variables (named by their env attribute); the backend itself is not started. Usage: exec -- <command> [<args>...]").
+		Action(this.cmdExec)
+	cmd.Arg("command", "Command (and its arguments) to execute.").
+		Required().
+		StringsVar(&this.args)
+}
+
+func (this *execCommand) cmdExec(*kingpin.ParseContext) error {
+	// Only the variables are required; the state is not touched at all.
+	return this.withClientFor(false, func(b *bitwarden.Bitwarden) error {
+		executable := utils.Executable(this.args[0])
+		args := this.args[1:]
+
+		vars, err := this.config.Variables.ResolveEnvironment(b)
+		if err != nil {
+			return executable.Errorf(args, "%w", err)
+		}
+
+		cmd, err := executable.Command(args...)
+		if err != nil {
+			return executable.Errorf(args, "%w", err)
+		}
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = utils.AddEnvironment(os.Environ(), vars)
+
+		err = cmd.Run()
+		if eErr, ok := err.(*exec.ExitError); ok {
+			this.ExitCode = eErr.ExitCode()
+			return nil
+		} else if err != nil {
+			return executable.Errorf(args, "%w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"os"
+	"testing"
+)
+
+func TestExecCommand_cmdExec_withoutState(t *testing.T) {
+	be, s := newFakeVaultBackend(t, `
+variable "db_password" {
+  name = "db"
+}
+`)
+	sb, _ := s.Bitwarden()
+	if _, err := sb.CreateItem(bitwarden.Item{
+		Type:  bitwarden.ItemTypeLogin,
+		Name:  "db",
+		Login: bitwarden.ItemLogin{Password: "secret"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	syncFakeVaultBackend(t, be)
+
+	// The configuration contains no state at all; so neither the item of the
+	// state nor the workspace must be required.
+	cmd := &execCommand{Backend: be, args: []string{"sh", "-c", `echo "$DB_PASSWORD" > out.txt; exit 3`}}
+	if err := cmd.cmdExec(nil); err != nil {
+		t.Fatal(err)
+	}
+	if be.ExitCode != 3 {
+		t.Errorf("expected exit code of the command but got %d", be.ExitCode)
+	}
+	actual, err := os.ReadFile("out.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(actual) != "secret\n" {
+		t.Errorf("expected variable in environment but got %q", actual)
+	}
+}
@@ -0,0 +1,360 @@
+package backend
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"github.com/hashicorp/go-uuid"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeVaultEnv contains the file of the vault if the test binary was executed
+// as a fake of the Bitwarden CLI.
+const fakeVaultEnv = "FAKE_BW_VAULT"
+
+func TestMain(m *testing.M) {
+	if fn := os.Getenv(fakeVaultEnv); fn != "" {
+		os.Exit(runFakeBitwarden(fn, os.Getenv("BW_SESSION"), os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// fakeVault emulates the parts of the Bitwarden server and its CLI which are
+// relevant for concurrency: every session has its own local copy of the
+// items which is only updated by sync and by the responses of its own writes.
+// Like the real server edits are rejected if they are based on an outdated
+// revision, but attachments are accepted regardless.
+type fakeVault struct {
+	Items       map[string]*bitwarden.Item            `json:"items"`
+	Attachments map[string][]byte                     `json:"attachments"`
+	Caches      map[string]map[string]*bitwarden.Item `json:"caches"`
+}
+
+func (this *fakeVault) cacheOf(session string) map[string]*bitwarden.Item {
+	if this.Caches == nil {
+		this.Caches = map[string]map[string]*bitwarden.Item{}
+	}
+	result := this.Caches[session]
+	if result == nil {
+		result = map[string]*bitwarden.Item{}
+		this.Caches[session] = result
+	}
+	return result
+}
+
+func (this *fakeVault) touch(item *bitwarden.Item) {
+	now := time.Now().UTC()
+	if item.RevisionDate != nil && !now.After(*item.RevisionDate) {
+		now = item.RevisionDate.Add(time.Microsecond)
+	}
+	item.RevisionDate = &now
+}
+
+func cloneItem(in *bitwarden.Item) *bitwarden.Item {
+	result := *in
+	result.AttachmentReferences = append(bitwarden.ItemAttachmentReferences{}, in.AttachmentReferences...)
+	return &result
+}
+
+func runFakeBitwarden(vaultFile, session string, args []string) int {
+	unlock, err := lockFakeVault(vaultFile)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer unlock()
+
+	var vault fakeVault
+	if b, err := os.ReadFile(vaultFile); err == nil {
+		if err := json.Unmarshal(b, &vault); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else if !os.IsNotExist(err) {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if vault.Items == nil {
+		vault.Items = map[string]*bitwarden.Item{}
+	}
+	if vault.Attachments == nil {
+		vault.Attachments = map[string][]byte{}
+	}
+
+	out, err := vault.execute(session, args)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	b, err := json.Marshal(vault)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := os.WriteFile(vaultFile, b, 0600); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	_, _ = os.Stdout.Write(out)
+	return 0
+}
+
+func lockFakeVault(vaultFile string) (func(), error) {
+	fn := vaultFile + ".lock"
+	for start := time.Now(); time.Since(start) < 30*time.Second; time.Sleep(time.Millisecond) {
+		f, err := os.OpenFile(fn, os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_ = f.Close()
+			return func() { _ = os.Remove(fn) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("cannot lock %s", vaultFile)
+}
+
+func fakeFlagOf(args []string, name string) string {
+	for i, arg := range args {
+		if arg == name && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func (this *fakeVault) execute(session string, args []string) ([]byte, error) {
+	if len(args) == 0 {
+		return nil, errors.New("no command")
+	}
+	cache := this.cacheOf(session)
+	command := strings.Join(args[:min(2, len(args))], " ")
+
+	switch {
+	case args[0] == "status":
+		return []byte(`{"userEmail":"test@example.org","status":"unlocked"}`), nil
+
+	case args[0] == "sync":
+		for id, item := range this.Items {
+			cache[id] = cloneItem(item)
+		}
+		for id := range cache {
+			if _, ok := this.Items[id]; !ok {
+				delete(cache, id)
+			}
+		}
+		return []byte("Syncing complete."), nil
+
+	case command == "list items":
+		search := strings.ToLower(fakeFlagOf(args, "--search"))
+		result := bitwarden.Items{}
+		for _, item := range cache {
+			if strings.Contains(strings.ToLower(item.Name), search) {
+				result = append(result, *item)
+			}
+		}
+		return json.Marshal(result)
+
+	case command == "get item":
+		item, ok := cache[args[2]]
+		if !ok {
+			return nil, errors.New("Not found.")
+		}
+		return json.Marshal(item)
+
+	case command == "create item":
+		var item bitwarden.Item
+		if err := decodeFakeItem(args[2], &item); err != nil {
+			return nil, err
+		}
+		id, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		item.Id = id
+		this.touch(&item)
+		this.Items[id] = &item
+		cache[id] = cloneItem(&item)
+		return json.Marshal(item)
+
+	case command == "edit item":
+		current, ok := this.Items[args[2]]
+		known, kOk := cache[args[2]]
+		if !ok || !kOk {
+			return nil, errors.New("Not found.")
+		}
+		if !known.RevisionDate.Equal(*current.RevisionDate) {
+			return nil, errors.New("The cipher you are updating is out of date. Please save your work, sync your vault, and try again.")
+		}
+		var item bitwarden.Item
+		if err := decodeFakeItem(args[3], &item); err != nil {
+			return nil, err
+		}
+		item.Id = current.Id
+		item.AttachmentReferences = current.AttachmentReferences
+		item.RevisionDate = current.RevisionDate
+		this.touch(&item)
+		this.Items[item.Id] = &item
+		cache[item.Id] = cloneItem(&item)
+		return json.Marshal(item)
+
+	case command == "create attachment":
+		item, ok := this.Items[fakeFlagOf(args, "--itemid")]
+		if !ok {
+			return nil, errors.New("Not found.")
+		}
+		fn := fakeFlagOf(args, "--file")
+		content, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		id, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		this.Attachments[id] = content
+		item.AttachmentReferences = append(item.AttachmentReferences, bitwarden.ItemAttachmentReference{
+			Id:       id,
+			FileName: filepath.Base(fn),
+			Size:     fmt.Sprint(len(content)),
+		})
+		this.touch(item)
+		cache[item.Id] = cloneItem(item)
+		return json.Marshal(item)
+
+	case command == "delete attachment":
+		item, ok := this.Items[fakeFlagOf(args, "--itemid")]
+		if !ok {
+			return nil, errors.New("Not found.")
+		}
+		id := args[len(args)-1]
+		var remaining bitwarden.ItemAttachmentReferences
+		for _, candidate := range item.AttachmentReferences {
+			if candidate.Id != id {
+				remaining = append(remaining, candidate)
+			}
+		}
+		if len(remaining) == len(item.AttachmentReferences) {
+			return nil, errors.New("Attachment not found.")
+		}
+		item.AttachmentReferences = remaining
+		delete(this.Attachments, id)
+		this.touch(item)
+		cache[item.Id] = cloneItem(item)
+		return nil, nil
+
+	case command == "get attachment":
+		content, ok := this.Attachments[args[2]]
+		if !ok {
+			return nil, errors.New("Attachment not found.")
+		}
+		return content, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported command: %v", args)
+	}
+}
+
+func decodeFakeItem(plain string, to *bitwarden.Item) error {
+	b, err := base64.StdEncoding.DecodeString(plain)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, to)
+}
+
+// setupFakeVault creates a new empty fake vault for the current test and
+// returns the executable which acts as the Bitwarden CLI for it.
+func setupFakeVault(t *testing.T) string {
+	t.Setenv(fakeVaultEnv, filepath.Join(t.TempDir(), "vault.json"))
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return executable
+}
+
+// newFakeVaultClient returns a store which uses the given session of the fake
+// vault set up by setupFakeVault.
+func newFakeVaultClient(t *testing.T, executable, session string, config ConfigState) *Store {
+	b, err := bitwarden.NewBitwarden(session, executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Store{StoreParent: &staticStoreParent{
+		bitwarden: b,
+		config:    Config{State: &config},
+	}}
+}
+
+// newFakeVaultClients returns stores which act as independent clients (each
+// one with its own session and local copy) of the same fake vault.
+func newFakeVaultClients(t *testing.T, config ConfigState, count int) []*Store {
+	executable := setupFakeVault(t)
+
+	cit := true
+	config.CreateIfMissing = &cit
+	result := make([]*Store, count)
+	for i := range result {
+		result[i] = newFakeVaultClient(t, executable, fmt.Sprintf("session-%d", i), config)
+	}
+	return result
+}
+
+// newFakeVaultBackend returns a backend which is configured by the given
+// local configuration file (inside of a new working directory) and uses a new
+// fake vault. The returned store accesses the same vault with another session.
+func newFakeVaultBackend(t *testing.T, config string) (*Backend, *Store) {
+	executable := setupFakeVault(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	// Neither the configuration nor the workspace of the user must be used.
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("TF_WORKSPACE", "")
+	t.Setenv("TF_DATA_DIR", "")
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	userConfigFile := filepath.Join(userConfigDir, "terraform-backend-bitwarden", "config.hcl")
+	if err := os.MkdirAll(filepath.Dir(userConfigFile), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(userConfigFile, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(localConfigFile, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock := false
+	result := &Backend{config: NewConfig(), overlayConfig: NewConfig()}
+	result.overlayConfig.Bitwarden = &ConfigBitwarden{
+		Executable:       executable,
+		Session:          "session-backend",
+		UnlockIfRequired: &unlock,
+	}
+	cit := true
+	return result, newFakeVaultClient(t, executable, "session-check", ConfigState{CreateIfMissing: &cit})
+}
+
+// syncFakeVaultBackend updates the cache of the session of the given backend;
+// so it knows about the items created by others (like the check store).
+func syncFakeVaultBackend(t *testing.T, be *Backend) {
+	bc := be.overlayConfig.GetBitwarden()
+	b, err := bc.NewBitwarden()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+}
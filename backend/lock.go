@@ -0,0 +1,341 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bhoriuchi/terraform-backend-http/go/store"
+	"github.com/bhoriuchi/terraform-backend-http/go/types"
+	log "github.com/echocat/slf4g"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"github.com/hashicorp/go-uuid"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+	"os/user"
+	"time"
+)
+
+const brokenLockFieldName = "terraform-lock-broken"
+const lockHeartbeatFieldName = "terraform-lock-heartbeat"
+
+// storedLock is the lock as it is stored in Bitwarden. It extends the lock of
+// Terraform by the time of the last heartbeat of its holder.
+type storedLock struct {
+	types.Lock
+	Heartbeat *time.Time `json:",omitempty"`
+}
+
+// lastSeen returns the time of the last heartbeat or (if absent) the time the
+// lock was created. It returns zero if neither is known.
+func (this storedLock) lastSeen() time.Time {
+	if v := this.Heartbeat; v != nil {
+		return *v
+	}
+	if v, err := time.Parse(time.RFC3339Nano, this.Created); err == nil {
+		return v
+	}
+	return time.Time{}
+}
+
+func (this storedLock) isExpired(ttl time.Duration) bool {
+	if ttl <= 0 {
+		return false
+	}
+	lastSeen := this.lastSeen()
+	return !lastSeen.IsZero() && time.Since(lastSeen) > ttl
+}
+
+// LockHeldError is returned if a lock should be modified which is held by
+// someone else.
+type LockHeldError struct {
+	Lock types.Lock
+}
+
+func (this *LockHeldError) Error() string {
+	return fmt.Sprintf("%v: state is locked by %s since %s (id: %s, operation: %s)", ErrLockConflict, this.Lock.Who, this.Lock.Created, this.Lock.ID, this.Lock.Operation)
+}
+
+func (this *LockHeldError) Unwrap() error {
+	return ErrLockConflict
+}
+
+// brokenLock records who broke which lock.
+type brokenLock struct {
+	Lock     types.Lock `json:"lock"`
+	BrokenBy string     `json:"brokenBy"`
+	BrokenAt time.Time  `json:"brokenAt"`
+}
+
+func newLock(operation string) (types.Lock, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return types.Lock{}, err
+	}
+	return types.Lock{
+		ID:        id,
+		Operation: operation,
+		Who:       whoAmI(),
+		Created:   time.Now().UTC().Format(time.RFC3339Nano),
+	}, nil
+}
+
+// whoAmI returns user@host like Terraform does for its locks.
+func whoAmI() string {
+	name, host := currentUserAndHost()
+	return name + "@" + host
+}
+
+func currentUserAndHost() (name, host string) {
+	name = "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return name, host
+}
+
+// lockHeartbeat is stored as hidden field of the item if the lock itself is
+// stored as attachment. This way the heartbeat can be updated in place
+// instead of uploading the whole lock again.
+type lockHeartbeat struct {
+	ID        string    `json:"id"`
+	Heartbeat time.Time `json:"heartbeat"`
+}
+
+// renewLock updates the heartbeat of the given lock. It fails with
+// ErrLockConflict if the lock is not held anymore.
+func (this *Store) renewLock(plainRef string, lock types.Lock) error {
+	this = this.scopedTo(plainRef)
+	b, err := this.Bitwarden()
+	if err != nil {
+		return err
+	}
+
+	return this.retryOnConcurrentModification(plainRef, func() error {
+		item, err := this.getItem(b, plainRef)
+		if err != nil {
+			return err
+		}
+		current, err := this.getLock(b, item)
+		if err == store.ErrNotFound {
+			return fmt.Errorf("%w: lock %s of item %v (%v) does not exist anymore", ErrLockConflict, lock.ID, item.Name, item.Id)
+		}
+		if err != nil {
+			return err
+		}
+		if current.ID != lock.ID {
+			return &LockHeldError{current.Lock}
+		}
+
+		now := time.Now().UTC()
+		if inNotes, err := this.getLockFromNotes(item); err != nil {
+			return err
+		} else if inNotes != nil && inNotes.ID == lock.ID {
+			if ok, err := this.putLockIntoNotes(b, item, &storedLock{Lock: current.Lock, Heartbeat: &now}); err != nil || ok {
+				return err
+			}
+		}
+		return this.putLockHeartbeat(b, item, lockHeartbeat{ID: lock.ID, Heartbeat: now})
+	})
+}
+
+func (this *Store) lockHeartbeatOf(item *bitwarden.Item) (*lockHeartbeat, error) {
+	for _, field := range item.Fields {
+		if field.Name == this.prefixed(lockHeartbeatFieldName) {
+			var result lockHeartbeat
+			if err := json.Unmarshal([]byte(field.Value), &result); err != nil {
+				return nil, fmt.Errorf("cannot decode field %s of item %v (%v): %w", lockHeartbeatFieldName, item.Name, item.Id, err)
+			}
+			return &result, nil
+		}
+	}
+	return nil, nil
+}
+
+func (this *Store) putLockHeartbeat(b *bitwarden.Bitwarden, item *bitwarden.Item, heartbeat lockHeartbeat) error {
+	encoded, err := json.Marshal(heartbeat)
+	if err != nil {
+		return fmt.Errorf("cannot encode lock heartbeat for item %v (%v): %w", item.Name, item.Id, err)
+	}
+	return this.setHiddenField(b, item, lockHeartbeatFieldName, string(encoded))
+}
+
+// applyLockHeartbeat updates the heartbeat of the given lock if the item
+// contains a newer one for it.
+func (this *Store) applyLockHeartbeat(item *bitwarden.Item, lock *storedLock) error {
+	heartbeat, err := this.lockHeartbeatOf(item)
+	if err != nil || heartbeat == nil || heartbeat.ID != lock.ID {
+		return err
+	}
+	if lock.Heartbeat == nil || heartbeat.Heartbeat.After(*lock.Heartbeat) {
+		lock.Heartbeat = &heartbeat.Heartbeat
+	}
+	return nil
+}
+
+func (this *Store) brokenLockOf(item *bitwarden.Item) (*brokenLock, error) {
+	for _, field := range item.Fields {
+		if field.Name == this.prefixed(brokenLockFieldName) {
+			var result brokenLock
+			if err := json.Unmarshal([]byte(field.Value), &result); err != nil {
+				return nil, fmt.Errorf("cannot decode field %s of item %v (%v): %w", brokenLockFieldName, item.Name, item.Id, err)
+			}
+			return &result, nil
+		}
+	}
+	return nil, nil
+}
+
+// recordBrokenLock stores the given record as hidden field of the item. Only
+// the latest record is kept.
+func (this *Store) recordBrokenLock(b *bitwarden.Bitwarden, item *bitwarden.Item, record brokenLock) error {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("cannot encode broken lock for item %v (%v): %w", item.Name, item.Id, err)
+	}
+	return this.setHiddenField(b, item, brokenLockFieldName, string(encoded))
+}
+
+// setHiddenField replaces the field with the given name (inside of the scope
+// of this store) by a hidden one with the given value. An empty value removes
+// the field.
+func (this *Store) setHiddenField(b *bitwarden.Bitwarden, item *bitwarden.Item, name, value string) error {
+	name = this.prefixed(name)
+	var fields []map[string]interface{}
+	for _, field := range item.Fields {
+		if field.Name == name {
+			continue
+		}
+		nv := map[string]interface{}{
+			"name":  field.Name,
+			"value": field.Value,
+			"type":  field.Type,
+		}
+		if field.LinkedId != "" {
+			nv["linkedId"] = field.LinkedId
+		}
+		fields = append(fields, nv)
+	}
+	if value != "" {
+		fields = append(fields, map[string]interface{}{
+			"name":  name,
+			"value": value,
+			"type":  1, // hidden
+		})
+	}
+
+	updated, err := b.EditItem(*item, map[string]interface{}{"fields": fields})
+	if err != nil {
+		return err
+	}
+	*item = *updated
+	return nil
+}
+
+type lockCommands struct {
+	*Backend
+
+	id string
+}
+
+func (this *lockCommands) register(app *kingpin.Application) {
+	cmd := app.Command("lock", "Inspects and manages the lock of the state stored in Bitwarden.")
+
+	cmd.Command("info", "Shows the current lock and who broke the last one.").
+		Action(this.cmdInfo)
+
+	breakCmd := cmd.Command("break", "Removes the current lock regardless who holds it and records who broke it.").
+		Action(this.cmdBreak)
+	breakCmd.Arg("id", "ID of the lock to break; if given the lock is only removed if it still has this ID.").
+		StringVar(&this.id)
+}
+
+func (this *lockCommands) cmdInfo(*kingpin.ParseContext) error {
+	return this.withLockItem(func(s *Store, b *bitwarden.Bitwarden, ref string, item *bitwarden.Item) error {
+		lock, err := s.getLock(b, item)
+		if err == store.ErrNotFound {
+			fmt.Println("State is not locked.")
+		} else if err != nil {
+			return err
+		} else {
+			fmt.Printf("ID:        %s\n", lock.ID)
+			fmt.Printf("Who:       %s\n", lock.Who)
+			fmt.Printf("Operation: %s\n", lock.Operation)
+			fmt.Printf("Created:   %s\n", lock.Created)
+			if v := lock.lastSeen(); !v.IsZero() {
+				fmt.Printf("Last seen: %s\n", v.Format(time.RFC3339))
+			}
+			if lock.Info != "" {
+				fmt.Printf("Info:      %s\n", lock.Info)
+			}
+			if ttl := this.config.GetState().GetLockTtl(); lock.isExpired(ttl) {
+				fmt.Printf("Expired:   yes (ttl: %v)\n", ttl)
+			}
+		}
+
+		broken, err := s.brokenLockOf(item)
+		if err != nil {
+			return err
+		}
+		if broken != nil {
+			fmt.Printf("\nLast broken lock %s (held by %s) was broken by %s at %s.\n", broken.Lock.ID, broken.Lock.Who, broken.BrokenBy, broken.BrokenAt.Format(time.RFC3339))
+		}
+		return nil
+	})
+}
+
+func (this *lockCommands) cmdBreak(*kingpin.ParseContext) error {
+	return this.withLockItem(func(s *Store, b *bitwarden.Bitwarden, ref string, item *bitwarden.Item) error {
+		lock, err := s.getLock(b, item)
+		if err == store.ErrNotFound {
+			return fmt.Errorf("state of item %v (%v) is not locked", item.Name, item.Id)
+		}
+		if err != nil {
+			return err
+		}
+		if this.id != "" && lock.ID != this.id {
+			return &LockHeldError{lock.Lock}
+		}
+
+		if err := s.DeleteLockOf(ref, lock.ID); err != nil {
+			return err
+		}
+		item, err = s.getItem(b, ref)
+		if err != nil {
+			return err
+		}
+		record := brokenLock{
+			Lock:     lock.Lock,
+			BrokenBy: whoAmI(),
+			BrokenAt: time.Now().UTC(),
+		}
+		if err := s.recordBrokenLock(b, item, record); err != nil {
+			return err
+		}
+
+		log.With("itemName", item.Name).
+			With("itemId", item.Id).
+			With("lockId", lock.ID).
+			With("who", lock.Who).
+			With("brokenBy", record.BrokenBy).
+			Warn("Lock broken.")
+		return nil
+	})
+}
+
+func (this *lockCommands) withLockItem(action func(s *Store, b *bitwarden.Bitwarden, ref string, item *bitwarden.Item) error) error {
+	return this.withClient(func(b *bitwarden.Bitwarden) error {
+		ref, err := this.config.GetState().StoreRefOfWorkspace(this.workspace)
+		if err != nil {
+			return err
+		}
+		s := (&Store{StoreParent: this.Backend}).scopedTo(ref.String())
+		item, err := s.getItem(b, ref.String())
+		if err != nil {
+			return err
+		}
+		return action(s, b, ref.String(), item)
+	})
+}
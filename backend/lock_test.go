@@ -0,0 +1,85 @@
+package backend
+
+import (
+	"errors"
+	"github.com/bhoriuchi/terraform-backend-http/go/store"
+	"github.com/bhoriuchi/terraform-backend-http/go/types"
+	"testing"
+)
+
+func TestStore_PutLock_refusesLockOfOtherHolder(t *testing.T) {
+	for _, storage := range []StateStorage{StateStorageAttachment, StateStorageNotes} {
+		t.Run(string(storage), func(t *testing.T) {
+			clients := newFakeVaultClients(t, ConfigState{Storage: storage}, 2)
+			a, b := clients[0], clients[1]
+
+			if err := a.PutLock(concurrencyTestRef, types.Lock{ID: "a"}); err != nil {
+				t.Fatal(err)
+			}
+			var lhErr *LockHeldError
+			if err := b.PutLock(concurrencyTestRef, types.Lock{ID: "b"}); !errors.As(err, &lhErr) || lhErr.Lock.ID != "a" {
+				t.Fatalf("expected lock to be held by a but got %v", err)
+			}
+
+			actual, err := b.GetLock(concurrencyTestRef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual.ID != "a" {
+				t.Errorf("expected lock a but got %s", actual.ID)
+			}
+		})
+	}
+}
+
+func TestStore_renewLock_updatesHeartbeatInPlace(t *testing.T) {
+	for _, storage := range []StateStorage{StateStorageAttachment, StateStorageNotes} {
+		t.Run(string(storage), func(t *testing.T) {
+			s := newFakeVaultClients(t, ConfigState{Storage: storage}, 1)[0]
+			lock := types.Lock{ID: "a"}
+			if err := s.PutLock(concurrencyTestRef, lock); err != nil {
+				t.Fatal(err)
+			}
+			b, _ := s.Bitwarden()
+			before, err := s.getItem(b, concurrencyTestRef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			beforeLock, err := s.getLock(b, before)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.renewLock(concurrencyTestRef, lock); err != nil {
+				t.Fatal(err)
+			}
+
+			after, err := s.getItem(b, concurrencyTestRef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			afterLock, err := s.getLock(b, after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !afterLock.Heartbeat.After(*beforeLock.Heartbeat) {
+				t.Errorf("expected heartbeat after %v but got %v", beforeLock.Heartbeat, afterLock.Heartbeat)
+			}
+			if len(after.AttachmentReferences) != len(before.AttachmentReferences) {
+				t.Fatalf("expected attachments %+v but got %+v", before.AttachmentReferences, after.AttachmentReferences)
+			}
+			for i, ref := range after.AttachmentReferences {
+				if ref.Id != before.AttachmentReferences[i].Id {
+					t.Errorf("expected attachments %+v but got %+v", before.AttachmentReferences, after.AttachmentReferences)
+				}
+			}
+
+			if err := s.DeleteLockOf(concurrencyTestRef, lock.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.GetLock(concurrencyTestRef); err != store.ErrNotFound {
+				t.Errorf("expected lock to be removed but got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"github.com/echocat/terraform-provider-bitwarden/plugin"
+)
+
+type RemoteStateReader struct{}
+
+func (this RemoteStateReader) ReadRemoteState(using *bitwarden.Bitwarden, q plugin.RemoteStateQuery) (*plugin.RemoteState, error) {
+	s := &Store{StoreParent: &staticStoreParent{
+		bitwarden: using,
+		config: Config{State: &ConfigState{
+			ItemId:          q.ItemId,
+			ItemName:        q.ItemName,
+			OrganizationId:  q.OrganizationId,
+			CollectionId:    q.CollectionId,
+			FolderId:        q.FolderId,
+			AmbiguityPolicy: q.AmbiguityPolicy,
+		}},
+	}}
+
+	ref := StoreRef{ItemId: q.ItemId, ItemName: q.ItemName}
+	item, err := s.getItem(using, ref.String())
+	if err != nil {
+		return nil, err
+	}
+
+	revs, err := s.stateRevisionsOf(item)
+	if err != nil {
+		return nil, err
+	}
+	if len(revs) == 0 {
+		return nil, fmt.Errorf("%w: item %v (%v) does not contain any state", plugin.ErrNoSuchRevision, item.Name, item.Id)
+	}
+
+	var rev *stateRevision
+	var state map[string]interface{}
+	if q.Revision != "" {
+		if rev = revs.lookup(q.Revision); rev == nil {
+			return nil, fmt.Errorf("%w: item %v (%v) does not contain revision %s", plugin.ErrNoSuchRevision, item.Name, item.Id, q.Revision)
+		}
+		if state, err = s.readStateRevision(using, item, *rev); err != nil {
+			return nil, err
+		}
+	} else if state, rev, err = s.readLatestStateRevision(using, item, revs); err != nil {
+		return nil, err
+	}
+
+	var decoded struct {
+		Serial           int64                               `json:"serial"`
+		Lineage          string                              `json:"lineage"`
+		TerraformVersion string                              `json:"terraform_version"`
+		Outputs          map[string]plugin.RemoteStateOutput `json:"outputs"`
+	}
+	if err := remarshal(state, &decoded); err != nil {
+		return nil, fmt.Errorf("cannot decode outputs of state revision %s of item %v (%v): %w", rev.revision(), item.Name, item.Id, err)
+	}
+
+	revisions := make([]string, len(revs))
+	for i, v := range revs {
+		revisions[i] = v.revision()
+	}
+
+	return &plugin.RemoteState{
+		Revision:         rev.revision(),
+		Revisions:        revisions,
+		Serial:           decoded.Serial,
+		Lineage:          decoded.Lineage,
+		TerraformVersion: decoded.TerraformVersion,
+		Outputs:          decoded.Outputs,
+	}, nil
+}
+
+func remarshal(from, to interface{}) error {
+	b, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, to)
+}
+
+type staticStoreParent struct {
+	bitwarden *bitwarden.Bitwarden
+	config    Config
+}
+
+func (this *staticStoreParent) Bitwarden() (*bitwarden.Bitwarden, error) {
+	return this.bitwarden, nil
+}
+
+func (this *staticStoreParent) GetOrganizationId() string {
+	return this.config.GetState().OrganizationId
+}
+
+func (this *staticStoreParent) GetCollectionId() string {
+	return this.config.GetState().CollectionId
+}
+
+func (this *staticStoreParent) GetFolderId() string {
+	return this.config.GetState().FolderId
+}
+
+func (this *staticStoreParent) GetConfig() Config {
+	return this.config
+}
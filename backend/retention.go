@@ -0,0 +1,110 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy decides which revisions of a state are kept. A revision is
+// kept if at least one of the rules (MaxRevisions, KeepHourly, KeepDaily or
+// KeepWeekly) selects it and it is not older than MaxAge. Protected revisions
+// are always kept.
+type RetentionPolicy struct {
+	MaxRevisions uint16
+	MaxAge       time.Duration
+	KeepHourly   uint16
+	KeepDaily    uint16
+	KeepWeekly   uint16
+}
+
+// Keep returns for each of the given revisions whether it should be kept.
+func (this RetentionPolicy) Keep(now time.Time, revisions []time.Time, protected ...time.Time) []bool {
+	order := make([]int, len(revisions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return revisions[order[a]].After(revisions[order[b]])
+	})
+
+	keep := make([]bool, len(revisions))
+	for rank, i := range order {
+		if rank < int(this.MaxRevisions) {
+			keep[i] = true
+		}
+	}
+
+	this.keepNewestPerBucket(keep, order, revisions, this.KeepHourly, func(t time.Time) string {
+		return t.UTC().Format("2006-01-02T15")
+	})
+	this.keepNewestPerBucket(keep, order, revisions, this.KeepDaily, func(t time.Time) string {
+		return t.UTC().Format("2006-01-02")
+	})
+	this.keepNewestPerBucket(keep, order, revisions, this.KeepWeekly, func(t time.Time) string {
+		year, week := t.UTC().ISOWeek()
+		return fmt.Sprintf("%d-%d", year, week)
+	})
+
+	if this.MaxAge > 0 {
+		for i, t := range revisions {
+			if now.Sub(t) > this.MaxAge {
+				keep[i] = false
+			}
+		}
+	}
+
+	for i, t := range revisions {
+		for _, p := range protected {
+			if t.Equal(p) {
+				keep[i] = true
+			}
+		}
+	}
+
+	return keep
+}
+
+func (this RetentionPolicy) keepNewestPerBucket(keep []bool, order []int, revisions []time.Time, amount uint16, bucketOf func(time.Time) string) {
+	if amount == 0 {
+		return
+	}
+	seen := map[string]struct{}{}
+	for _, i := range order {
+		bucket := bucketOf(revisions[i])
+		if _, ok := seen[bucket]; ok {
+			continue
+		}
+		if len(seen) >= int(amount) {
+			return
+		}
+		seen[bucket] = struct{}{}
+		keep[i] = true
+	}
+}
+
+// expiredRevisionsOf returns all revisions which have to be removed if a new
+// revision will be written at the given time. The latest existing revision
+// (currently live) and the written one are never part of the result.
+func (this *Store) expiredRevisionsOf(revs stateRevisions, written time.Time) stateRevisions {
+	times := make([]time.Time, len(revs)+1)
+	for i, rev := range revs {
+		times[i] = rev.time
+	}
+	times[len(revs)] = written
+
+	protected := []time.Time{written}
+	if len(revs) > 0 {
+		protected = append(protected, revs[0].time)
+	}
+
+	keep := this.GetConfig().GetState().GetRetentionPolicy().Keep(written, times, protected...)
+
+	var result stateRevisions
+	for i, rev := range revs {
+		if !keep[i] {
+			result = append(result, rev)
+		}
+	}
+	return result
+}
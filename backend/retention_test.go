@@ -0,0 +1,159 @@
+package backend
+
+import (
+	"testing"
+	"time"
+)
+
+// 2026-10-14 is a Wednesday; so the same ISO week spans from 2026-10-12 till
+// 2026-10-18.
+var retentionTestNow = time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+func retentionTestTime(plain string) time.Time {
+	result, err := time.Parse("2006-01-02T15:04", plain)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func TestRetentionPolicy_Keep(t *testing.T) {
+	cases := []struct {
+		name      string
+		policy    RetentionPolicy
+		revisions []string
+		protected []string
+		expected  []bool
+	}{{
+		name:      "max_revisions keeps the newest regardless of order",
+		policy:    RetentionPolicy{MaxRevisions: 2},
+		revisions: []string{"2026-10-14T09:00", "2026-10-14T11:00", "2026-10-14T08:00", "2026-10-14T10:00"},
+		expected:  []bool{false, true, false, true},
+	}, {
+		name:      "max_revisions larger than existing",
+		policy:    RetentionPolicy{MaxRevisions: 10},
+		revisions: []string{"2026-10-14T09:00", "2026-10-14T11:00"},
+		expected:  []bool{true, true},
+	}, {
+		name:      "without rules nothing is kept",
+		policy:    RetentionPolicy{},
+		revisions: []string{"2026-10-14T09:00", "2026-10-14T11:00"},
+		expected:  []bool{false, false},
+	}, {
+		name:      "max_age removes old revisions kept by other rules",
+		policy:    RetentionPolicy{MaxRevisions: 10, MaxAge: 2 * time.Hour},
+		revisions: []string{"2026-10-14T11:30", "2026-10-14T10:00", "2026-10-14T09:59", "2026-10-01T00:00"},
+		expected:  []bool{true, true, false, false},
+	}, {
+		name:      "keep_hourly keeps the newest of each of the latest hours",
+		policy:    RetentionPolicy{KeepHourly: 2},
+		revisions: []string{"2026-10-14T11:50", "2026-10-14T11:10", "2026-10-14T10:30", "2026-10-14T10:05", "2026-10-14T09:00"},
+		expected:  []bool{true, false, true, false, false},
+	}, {
+		name:      "keep_daily keeps the newest of each of the latest days",
+		policy:    RetentionPolicy{KeepDaily: 3},
+		revisions: []string{"2026-10-14T11:00", "2026-10-14T08:00", "2026-10-12T23:00", "2026-10-12T01:00", "2026-10-10T12:00", "2026-10-09T12:00"},
+		expected:  []bool{true, false, true, false, true, false},
+	}, {
+		name:      "keep_weekly keeps the newest of each of the latest ISO weeks",
+		policy:    RetentionPolicy{KeepWeekly: 2},
+		revisions: []string{"2026-10-14T11:00", "2026-10-12T00:00", "2026-10-11T23:00", "2026-10-05T00:00", "2026-10-04T12:00"},
+		expected:  []bool{true, false, true, false, false},
+	}, {
+		name:      "rules are combined",
+		policy:    RetentionPolicy{MaxRevisions: 1, KeepDaily: 2},
+		revisions: []string{"2026-10-14T11:00", "2026-10-14T10:00", "2026-10-13T10:00", "2026-10-13T09:00"},
+		expected:  []bool{true, false, true, false},
+	}, {
+		name:      "protected revisions are always kept",
+		policy:    RetentionPolicy{MaxRevisions: 1, MaxAge: time.Hour},
+		revisions: []string{"2026-10-14T11:30", "2026-10-14T11:00", "2026-10-01T00:00"},
+		protected: []string{"2026-10-01T00:00"},
+		expected:  []bool{true, false, true},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			revisions := make([]time.Time, len(c.revisions))
+			for i, v := range c.revisions {
+				revisions[i] = retentionTestTime(v)
+			}
+			protected := make([]time.Time, len(c.protected))
+			for i, v := range c.protected {
+				protected[i] = retentionTestTime(v)
+			}
+
+			actual := c.policy.Keep(retentionTestNow, revisions, protected...)
+
+			if len(actual) != len(c.expected) {
+				t.Fatalf("expected %d results but got %d", len(c.expected), len(actual))
+			}
+			for i := range actual {
+				if actual[i] != c.expected[i] {
+					t.Errorf("revision %s: expected keep=%v but got %v", c.revisions[i], c.expected[i], actual[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStore_expiredRevisionsOf(t *testing.T) {
+	s := &Store{StoreParent: &staticStoreParent{config: Config{State: &ConfigState{
+		MaxRevisions: 1,
+		MaxAge:       "1h",
+	}}}}
+
+	live := retentionTestTime("2026-10-01T00:00")
+	older := retentionTestTime("2026-09-30T00:00")
+	revs := stateRevisions{{time: live}, {time: older}}
+
+	actual := s.expiredRevisionsOf(revs, retentionTestNow)
+
+	// The just written revision occupies max_revisions and the live one is
+	// much older than max_age, but it must not be removed anyway.
+	if len(actual) != 1 || !actual[0].time.Equal(older) {
+		t.Errorf("expected only %v to expire but got %+v", older, actual)
+	}
+}
+
+func TestStore_expiredRevisionsOf_withoutExisting(t *testing.T) {
+	s := &Store{StoreParent: &staticStoreParent{config: Config{State: &ConfigState{}}}}
+
+	if actual := s.expiredRevisionsOf(nil, retentionTestNow); len(actual) != 0 {
+		t.Errorf("expected nothing to expire but got %+v", actual)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	cases := []struct {
+		plain       string
+		expected    time.Duration
+		expectError bool
+	}{
+		{"", 0, false},
+		{"90m", 90 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{" 2w ", 14 * 24 * time.Hour, false},
+		{"1.5d", 0, true},
+		{"-1d", 0, true},
+		{"foo", 0, true},
+	}
+	for _, c := range cases {
+		t.Run(c.plain, func(t *testing.T) {
+			actual, err := ParseDuration(c.plain)
+			if c.expectError {
+				if err == nil {
+					t.Errorf("expected error but got %v", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != c.expected {
+				t.Errorf("expected %v but got %v", c.expected, actual)
+			}
+		})
+	}
+}
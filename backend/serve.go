@@ -0,0 +1,133 @@
+package backend
+
+import (
+	"fmt"
+	log "github.com/echocat/slf4g"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// sessionCheckInterval is the interval in which serve checks if the session
+// of Bitwarden is still usable and unlocks it again if not.
+const sessionCheckInterval = time.Minute
+
+type serveCommand struct {
+	*Backend
+
+	password    string
+	idleTimeout time.Duration
+}
+
+func (this *serveCommand) register(app *kingpin.Application) {
+	cmd := app.Command("serve", "Starts the backend without Terraform and keeps it running. Every state is addressed by ?item=id:<id> or ?item=name:<name>; states sharing one item are addressed by ?item=prefix:<attachment prefix>:id:<id> (or name:<name>).").
+		Action(this.cmdServe)
+	cmd.Flag("password", "Password clients have to provide (as TF_HTTP_PASSWORD with TF_HTTP_USERNAME="+serverUsername+"). If absent a random one is generated and printed.").
+		Envar("TF_BACKEND_PASSWORD").
+		StringVar(&this.password)
+	cmd.Flag("idle-timeout", "Stops the backend after no request was received for this duration (0 = never).").
+		Envar("TF_BACKEND_IDLE_TIMEOUT").
+		DurationVar(&this.idleTimeout)
+}
+
+func (this *serveCommand) cmdServe(*kingpin.ParseContext) (rErr error) {
+	// Every request addresses its state itself; so neither a state item nor
+	// a workspace is required.
+	if err := this.initializeConfigFor(false); err != nil {
+		return err
+	}
+	this.serving = true
+	if this.password != "" {
+		this.credentials = serverCredentials{username: serverUsername, password: this.password}
+	}
+	if err := this.initializeServer(); err != nil {
+		return err
+	}
+	defer func() {
+		if err := this.Close(); err != nil && rErr == nil {
+			rErr = err
+		}
+	}()
+
+	address, err := this.serverAddress()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Serving Terraform HTTP backend at %s?item=id:<id> or %s?item=name:<name>\n", address, address)
+	if this.password == "" {
+		fmt.Printf("  TF_HTTP_USERNAME=%s\n", this.credentials.username)
+		fmt.Printf("  TF_HTTP_PASSWORD=%s\n", this.credentials.password)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	this.handleMutex.Lock()
+	this.lastRequest = time.Now()
+	this.handleMutex.Unlock()
+
+	ticker := time.NewTicker(this.tickInterval())
+	defer ticker.Stop()
+
+	lastSessionCheck := time.Now()
+	for {
+		select {
+		case sig := <-signals:
+			log.With("signal", sig.String()).
+				Info("Received signal; shutting down.")
+			return nil
+		case err := <-this.serveErr:
+			return fmt.Errorf("backend server failed: %w", err)
+		case now := <-ticker.C:
+			if this.isIdle(now) {
+				log.With("idleTimeout", this.idleTimeout).
+					Info("No requests received for too long; shutting down.")
+				return nil
+			}
+			if now.Sub(lastSessionCheck) >= sessionCheckInterval {
+				lastSessionCheck = now
+				this.ensureSession()
+			}
+		}
+	}
+}
+
+func (this *serveCommand) tickInterval() time.Duration {
+	if v := this.idleTimeout; v > 0 && v < sessionCheckInterval {
+		return v / 2
+	}
+	return sessionCheckInterval
+}
+
+func (this *serveCommand) isIdle(now time.Time) bool {
+	if this.idleTimeout <= 0 {
+		return false
+	}
+	this.handleMutex.Lock()
+	defer this.handleMutex.Unlock()
+	return now.Sub(this.lastRequest) > this.idleTimeout
+}
+
+// ensureSession unlocks Bitwarden again, if its session has expired.
+func (this *serveCommand) ensureSession() {
+	this.handleMutex.Lock()
+	defer this.handleMutex.Unlock()
+
+	b, err := this.Bitwarden()
+	if err != nil {
+		return
+	}
+	if ok, err := b.Test(); err == nil && ok {
+		return
+	}
+	log.Warn("Session of Bitwarden is not usable anymore; re-authenticating.")
+	if err := b.Unlock(true); err != nil {
+		log.WithError(err).
+			Error("Cannot re-authenticate at Bitwarden; requests will fail until it succeeds.")
+		return
+	}
+	log.Info("Re-authenticated at Bitwarden.")
+}
@@ -0,0 +1,92 @@
+package backend
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+)
+
+const serverUsername = "terraform"
+
+// serverCredentials are generated for each run and are only known to the
+// Terraform process started by this backend.
+type serverCredentials struct {
+	username string
+	password string
+}
+
+func newServerCredentials() (serverCredentials, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return serverCredentials{}, fmt.Errorf("cannot generate credentials for backend: %w", err)
+	}
+	return serverCredentials{
+		username: serverUsername,
+		password: hex.EncodeToString(buf),
+	}, nil
+}
+
+func (this serverCredentials) isAuthorized(r *http.Request) bool {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	usernameOk := subtle.ConstantTimeCompare([]byte(username), []byte(this.username)) == 1
+	passwordOk := subtle.ConstantTimeCompare([]byte(password), []byte(this.password)) == 1
+	return usernameOk && passwordOk
+}
+
+// serverCertificate is a self-signed certificate for the loopback interface
+// which is generated for each run.
+type serverCertificate struct {
+	certificate tls.Certificate
+	pem         []byte
+}
+
+func newServerCertificate() (*serverCertificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate key for backend: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate certificate for backend: %w", err)
+	}
+
+	now := time.Now()
+	tmpl := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "terraform-backend-bitwarden"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(7 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate certificate for backend: %w", err)
+	}
+
+	return &serverCertificate{
+		certificate: tls.Certificate{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+		},
+		pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}, nil
+}
@@ -0,0 +1,385 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bhoriuchi/terraform-backend-http/go/store"
+	log "github.com/echocat/slf4g"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"io"
+	"os"
+)
+
+type stateCommands struct {
+	*Backend
+
+	revision      string
+	otherRevision string
+	file          string
+	force         bool
+}
+
+func (this *stateCommands) register(app *kingpin.Application) {
+	cmd := app.Command("state", "Inspects and manages the revisions of the state stored in Bitwarden.")
+
+	cmd.Command("history", "Lists all stored revisions of the state, the newest first.").
+		Action(this.cmdHistory)
+
+	showCmd := cmd.Command("show", "Prints the state of the given revision.").
+		Action(this.cmdShow)
+	showCmd.Arg("revision", "Revision to print.").
+		Required().
+		StringVar(&this.revision)
+
+	diffCmd := cmd.Command("diff", "Prints the differences between two revisions.").
+		Action(this.cmdDiff)
+	diffCmd.Arg("revA", "Revision to compare from.").
+		Required().
+		StringVar(&this.revision)
+	diffCmd.Arg("revB", "Revision to compare to.").
+		Required().
+		StringVar(&this.otherRevision)
+
+	rollbackCmd := cmd.Command("rollback", "Restores the given revision by writing it as a new revision.").
+		Action(this.cmdRollback)
+	rollbackCmd.Arg("revision", "Revision to restore.").
+		Required().
+		StringVar(&this.revision)
+	rollbackCmd.Flag("force", "Restores the revision even if its lineage differs from the one of the latest state.").
+		BoolVar(&this.force)
+
+	cmd.Command("verify", "Verifies the integrity of all stored revisions.").
+		Action(this.cmdVerify)
+
+	cmd.Command("pull", "Prints the latest state to stdout.").
+		Action(this.cmdPull)
+
+	pushCmd := cmd.Command("push", "Writes the given local state as new revision.").
+		Action(this.cmdPush)
+	pushCmd.Arg("file", "File which contains the state to push ('-' for stdin).").
+		Required().
+		StringVar(&this.file)
+	pushCmd.Flag("force", "Writes the state even if its lineage or serial does not succeed the stored one.").
+		BoolVar(&this.force)
+
+	importCmd := cmd.Command("import", "Imports the given local state (like terraform.tfstate of another backend); creates the item if it does not exist yet.").
+		Action(this.cmdImport)
+	importCmd.Arg("file", "File which contains the state to import ('-' for stdin).").
+		Required().
+		StringVar(&this.file)
+	importCmd.Flag("force", "Imports the state even if its lineage or serial does not succeed the stored one.").
+		BoolVar(&this.force)
+}
+
+func (this *stateCommands) cmdHistory(*kingpin.ParseContext) error {
+	return this.withStateItem(func(s *Store, b *bitwarden.Bitwarden, item *bitwarden.Item, revs stateRevisions) error {
+		for i, rev := range revs {
+			marker := " "
+			if i == 0 {
+				marker = "*"
+			}
+			fmt.Printf("%s %s  %-10s  %s\n", marker, rev.revision(), rev.storage(), rev.size())
+
+			metadata, err := s.readStateMetadata(b, item, rev)
+			if err != nil {
+				return err
+			}
+			if len(metadata) > 0 {
+				fmt.Printf("    by %s@%s", metadataStringOf(metadata, metadataWho), metadataStringOf(metadata, metadataHost))
+				if v := metadataStringOf(metadata, metadataTerraformVersion); v != "" {
+					fmt.Printf(" using terraform %s", v)
+				}
+				if v := metadataStringOf(metadata, metadataGitCommit); v != "" {
+					fmt.Printf(" at commit %s", v)
+				}
+				fmt.Println()
+				if v := metadataStringOf(metadata, metadataCommandLine); v != "" {
+					fmt.Printf("    $ %s\n", v)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (this *stateCommands) cmdShow(*kingpin.ParseContext) error {
+	return this.withStateItem(func(s *Store, b *bitwarden.Bitwarden, item *bitwarden.Item, revs stateRevisions) error {
+		state, err := this.readRevision(s, b, item, revs, this.revision)
+		if err != nil {
+			return err
+		}
+		encoded, err := json.MarshalIndent(state, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(encoded))
+		return nil
+	})
+}
+
+func (this *stateCommands) cmdDiff(*kingpin.ParseContext) error {
+	return this.withStateItem(func(s *Store, b *bitwarden.Bitwarden, item *bitwarden.Item, revs stateRevisions) error {
+		a, err := this.readRevisionLines(s, b, item, revs, this.revision)
+		if err != nil {
+			return err
+		}
+		o, err := this.readRevisionLines(s, b, item, revs, this.otherRevision)
+		if err != nil {
+			return err
+		}
+		return difflib.WriteUnifiedDiff(os.Stdout, difflib.UnifiedDiff{
+			A:        a,
+			B:        o,
+			FromFile: this.revision,
+			ToFile:   this.otherRevision,
+			Context:  3,
+		})
+	})
+}
+
+func (this *stateCommands) cmdRollback(*kingpin.ParseContext) error {
+	return this.withStateItem(func(s *Store, b *bitwarden.Bitwarden, item *bitwarden.Item, revs stateRevisions) error {
+		state, err := this.readRevision(s, b, item, revs, this.revision)
+		if err != nil {
+			return err
+		}
+
+		return this.withLock(s, "rollback", func(ref string) error {
+			// The latest state has to be read while the lock is held, otherwise
+			// a concurrent apply could write a newer serial in between.
+			current, err := s.getItem(b, ref)
+			if err != nil {
+				return err
+			}
+			currentRevs, err := s.stateRevisionsOf(current)
+			if err != nil {
+				return err
+			}
+			latest, _, err := s.readLatestStateRevision(b, current, currentRevs)
+			if err != nil {
+				return err
+			}
+			// Terraform refuses states with a serial lower than the one it has
+			// seen before; so the restored state continues the latest serial.
+			state["serial"] = stateSerialOf(latest) + 1
+
+			// Only the lineage can conflict: the revision was written before
+			// the state was replaced by another one (like by push --force).
+			this.ignoreStateConflicts = this.ignoreStateConflicts || this.force
+			if err := s.PutState(ref, state, newStateMetadata(state, []string{"state", "rollback", this.revision}), false); errors.Is(err, ErrStateConflict) {
+				return fmt.Errorf("%w; use --force to roll back anyway", err)
+			} else if err != nil {
+				return err
+			}
+			log.With("itemName", item.Name).
+				With("itemId", item.Id).
+				With("revision", this.revision).
+				Info("State rolled back.")
+			return nil
+		})
+	})
+}
+
+func (this *stateCommands) cmdVerify(*kingpin.ParseContext) error {
+	return this.withStateItem(func(s *Store, b *bitwarden.Bitwarden, item *bitwarden.Item, revs stateRevisions) error {
+		var corrupt int
+		for _, rev := range revs {
+			_, err := s.readStateRevision(b, item, rev)
+			switch {
+			case errors.Is(err, ErrStateCorrupt):
+				corrupt++
+				fmt.Printf("%s  CORRUPT     %v\n", rev.revision(), err)
+			case err != nil:
+				return err
+			case !rev.digest().isPresent():
+				fmt.Printf("%s  UNVERIFIED  (written without digest)\n", rev.revision())
+			default:
+				fmt.Printf("%s  OK          sha256:%s\n", rev.revision(), rev.digest().Sha256)
+			}
+		}
+		if corrupt > 0 {
+			return fmt.Errorf("%w: %d of %d revisions of item %v (%v) are corrupt", ErrStateCorrupt, corrupt, len(revs), item.Name, item.Id)
+		}
+		return nil
+	})
+}
+
+func (this *stateCommands) cmdPull(*kingpin.ParseContext) error {
+	return this.withClient(func(b *bitwarden.Bitwarden) error {
+		ref, err := this.storeRef()
+		if err != nil {
+			return err
+		}
+		state, _, err := (&Store{StoreParent: this.Backend}).GetState(ref)
+		if err == store.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		encoded, err := json.MarshalIndent(state, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(encoded))
+		return nil
+	})
+}
+
+func (this *stateCommands) cmdPush(*kingpin.ParseContext) error {
+	return this.push(false)
+}
+
+func (this *stateCommands) cmdImport(*kingpin.ParseContext) error {
+	return this.push(true)
+}
+
+func (this *stateCommands) push(createIfMissing bool) error {
+	state, err := this.readStateFile()
+	if err != nil {
+		return err
+	}
+
+	return this.withClient(func(b *bitwarden.Bitwarden) error {
+		ref, err := this.storeRef()
+		if err != nil {
+			return err
+		}
+		s := (&Store{StoreParent: this.Backend}).scopedTo(ref)
+
+		item, err := s.getItem(b, ref)
+		if err == bitwarden.ErrNoSuchItem && createIfMissing {
+			if item, err = s.createItem(b, ref); err != nil {
+				return err
+			}
+			log.With("itemName", item.Name).
+				With("itemId", item.Id).
+				Info("Item for state created.")
+		}
+		if err != nil {
+			return err
+		}
+
+		// --force must not turn off a global --state.force.
+		this.ignoreStateConflicts = this.ignoreStateConflicts || this.force
+		return this.withLock(s, "push", func(ref string) error {
+			if err := s.PutState(ref, state, newStateMetadata(state, []string{"state", "push", this.file}), false); errors.Is(err, ErrStateConflict) {
+				return fmt.Errorf("%w; use --force to push it anyway", err)
+			} else if err != nil {
+				return err
+			}
+			log.With("itemName", item.Name).
+				With("itemId", item.Id).
+				With("serial", stateSerialOf(state)).
+				With("lineage", stateLineageOf(state)).
+				Info("State pushed.")
+			return nil
+		})
+	})
+}
+
+func (this *stateCommands) readStateFile() (map[string]interface{}, error) {
+	var content []byte
+	var err error
+	if this.file == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(this.file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read state from %s: %w", this.file, err)
+	}
+
+	state := map[string]interface{}{}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("cannot decode state of %s: %w", this.file, err)
+	}
+	if _, ok := state["version"]; !ok {
+		return nil, fmt.Errorf("%s does not contain a valid state: attribute version is missing", this.file)
+	}
+	return state, nil
+}
+
+func (this *stateCommands) storeRef() (string, error) {
+	ref, err := this.config.GetState().StoreRefOfWorkspace(this.workspace)
+	if err != nil {
+		return "", err
+	}
+	return ref.String(), nil
+}
+
+func (this *stateCommands) withStateItem(action func(s *Store, b *bitwarden.Bitwarden, item *bitwarden.Item, revs stateRevisions) error) error {
+	return this.withClient(func(b *bitwarden.Bitwarden) error {
+		ref, err := this.storeRef()
+		if err != nil {
+			return err
+		}
+		s := (&Store{StoreParent: this.Backend}).scopedTo(ref)
+		item, err := s.getItem(b, ref)
+		if err != nil {
+			return err
+		}
+		revs, err := s.stateRevisionsOf(item)
+		if err != nil {
+			return err
+		}
+		if len(revs) == 0 {
+			return fmt.Errorf("item %v (%v) does not contain any state", item.Name, item.Id)
+		}
+		return action(s, b, item, revs)
+	})
+}
+
+// withLock acquires the lock of the state for the time of the given action.
+// It fails if the state is already locked by someone else.
+func (this *stateCommands) withLock(s *Store, operation string, action func(ref string) error) (rErr error) {
+	ref, err := this.storeRef()
+	if err != nil {
+		return err
+	}
+
+	existing, err := s.GetLock(ref)
+	if err == nil {
+		return &LockHeldError{*existing}
+	} else if err != store.ErrNotFound {
+		return err
+	}
+
+	lock, err := newLock(operation)
+	if err != nil {
+		return err
+	}
+	if err := s.PutLock(ref, lock); err != nil {
+		return err
+	}
+	defer func() {
+		if err := s.DeleteLockOf(ref, lock.ID); err != nil && rErr == nil {
+			rErr = err
+		}
+	}()
+
+	return action(ref)
+}
+
+func (this *stateCommands) readRevision(s *Store, b *bitwarden.Bitwarden, item *bitwarden.Item, revs stateRevisions, revision string) (map[string]interface{}, error) {
+	rev := revs.lookup(revision)
+	if rev == nil {
+		return nil, fmt.Errorf("item %v (%v) does not contain revision %s", item.Name, item.Id, revision)
+	}
+	return s.readStateRevision(b, item, *rev)
+}
+
+func (this *stateCommands) readRevisionLines(s *Store, b *bitwarden.Bitwarden, item *bitwarden.Item, revs stateRevisions, revision string) ([]string, error) {
+	state, err := this.readRevision(s, b, item, revs, revision)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return difflib.SplitLines(string(encoded) + "\n"), nil
+}
@@ -0,0 +1,131 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+const stateCommandsTestConfig = `
+state {
+  item_name     = "terraform-state"
+  max_revisions = 5
+}
+`
+
+func stateCommandsTestState(lineage string, serial int) map[string]interface{} {
+	return map[string]interface{}{
+		"version": float64(4),
+		"lineage": lineage,
+		"serial":  float64(serial),
+	}
+}
+
+func writeTestStateFile(t *testing.T, state map[string]interface{}) string {
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := "state.json"
+	if err := os.WriteFile(fn, encoded, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func latestTestState(t *testing.T, s *Store) map[string]interface{} {
+	state, _, err := s.GetState(concurrencyTestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestStateCommands_cmdRollback_acrossLineage(t *testing.T) {
+	be, s := newFakeVaultBackend(t, stateCommandsTestConfig)
+	newCommands := func() *stateCommands {
+		return &stateCommands{Backend: &Backend{config: NewConfig(), overlayConfig: be.overlayConfig}}
+	}
+
+	if err := s.PutState(concurrencyTestRef, stateCommandsTestState("a", 3), nil, false); err != nil {
+		t.Fatal(err)
+	}
+	push := newCommands()
+	push.file = writeTestStateFile(t, stateCommandsTestState("b", 1))
+	push.force = true
+	if err := push.cmdPush(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	sb, _ := s.Bitwarden()
+	item, err := s.getItem(sb, concurrencyTestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revs, err := s.stateRevisionsOf(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revision := revs[1].revision()
+
+	rollback := newCommands()
+	rollback.revision = revision
+	if err := rollback.cmdRollback(nil); !errors.Is(err, ErrStateConflict) {
+		t.Fatalf("expected state conflict but got %v", err)
+	}
+	if actual := latestTestState(t, s); stateLineageOf(actual) != "b" {
+		t.Fatalf("expected rejected rollback not to be written but got %v", actual)
+	}
+
+	rollback = newCommands()
+	rollback.revision = revision
+	rollback.force = true
+	if err := rollback.cmdRollback(nil); err != nil {
+		t.Fatal(err)
+	}
+	if actual := latestTestState(t, s); stateLineageOf(actual) != "a" || stateSerialOf(actual) != 2 {
+		t.Errorf("expected lineage a with serial 2 but got %v", actual)
+	}
+}
+
+func TestStateCommands_cmdPush_force(t *testing.T) {
+	cases := []struct {
+		name        string
+		globalForce bool
+		force       bool
+		expectedErr error
+	}{
+		{"without any force", false, false, ErrStateConflict},
+		{"with --force", false, true, nil},
+		{"with --state.force", true, false, nil},
+		{"with both", true, true, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			be, s := newFakeVaultBackend(t, stateCommandsTestConfig)
+			if err := s.PutState(concurrencyTestRef, stateCommandsTestState("a", 3), nil, false); err != nil {
+				t.Fatal(err)
+			}
+
+			be.ignoreStateConflicts = c.globalForce
+			push := &stateCommands{Backend: be}
+			push.file = writeTestStateFile(t, stateCommandsTestState("b", 1))
+			push.force = c.force
+			if err := push.cmdPush(nil); !errors.Is(err, c.expectedErr) {
+				t.Fatalf("expected error %v but got %v", c.expectedErr, err)
+			}
+
+			expectedLineage := "b"
+			if c.expectedErr != nil {
+				expectedLineage = "a"
+			}
+			if actual := latestTestState(t, s); stateLineageOf(actual) != expectedLineage {
+				t.Errorf("expected lineage %s but got %v", expectedLineage, actual)
+			}
+			if be.ignoreStateConflicts != (c.globalForce || c.force) {
+				t.Errorf("expected state conflicts to be ignored=%v but got %v", c.globalForce || c.force, be.ignoreStateConflicts)
+			}
+		})
+	}
+}
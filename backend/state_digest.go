@@ -0,0 +1,50 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrStateCorrupt is returned if the content of a revision does not
+	// match its digest.
+	ErrStateCorrupt = errors.New("state corrupt")
+)
+
+// stateDigest identifies the content of a revision. Revisions written by
+// older versions do not have a digest and cannot be verified.
+type stateDigest struct {
+	Sha256 string
+	Size   int64
+}
+
+func digestOf(content []byte) stateDigest {
+	sum := sha256.Sum256(content)
+	return stateDigest{
+		Sha256: hex.EncodeToString(sum[:]),
+		Size:   int64(len(content)),
+	}
+}
+
+func (this stateDigest) isPresent() bool {
+	return this.Sha256 != ""
+}
+
+func (this stateDigest) verify(content []byte) error {
+	if !this.isPresent() {
+		return nil
+	}
+	if int64(len(content)) != this.Size {
+		return fmt.Errorf("%w: expected %d bytes but got %d bytes", ErrStateCorrupt, this.Size, len(content))
+	}
+	if actual := digestOf(content); actual.Sha256 != this.Sha256 {
+		return fmt.Errorf("%w: expected sha256 %s but got %s", ErrStateCorrupt, this.Sha256, actual.Sha256)
+	}
+	return nil
+}
+
+func (this stateDigest) fileNameSuffix() string {
+	return fmt.Sprintf(".sha256-%s.size-%d", this.Sha256, this.Size)
+}
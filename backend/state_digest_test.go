@@ -0,0 +1,158 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"testing"
+	"time"
+)
+
+func TestDigestOf(t *testing.T) {
+	cases := []struct {
+		content  string
+		expected stateDigest
+		suffix   string
+	}{
+		{"", stateDigest{"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", 0}, ".sha256-e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855.size-0"},
+		{"foo", stateDigest{"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", 3}, ".sha256-2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae.size-3"},
+	}
+	for _, c := range cases {
+		t.Run(c.content, func(t *testing.T) {
+			actual := digestOf([]byte(c.content))
+			if actual != c.expected {
+				t.Errorf("expected %+v but got %+v", c.expected, actual)
+			}
+			if actual.fileNameSuffix() != c.suffix {
+				t.Errorf("expected suffix %s but got %s", c.suffix, actual.fileNameSuffix())
+			}
+		})
+	}
+}
+
+func TestStateDigest_verify(t *testing.T) {
+	foo := digestOf([]byte("foo"))
+	cases := []struct {
+		name    string
+		digest  stateDigest
+		content string
+		corrupt bool
+	}{
+		{"matching", foo, "foo", false},
+		{"other size", foo, "fooo", true},
+		{"same size", foo, "bar", true},
+		{"matching size only", stateDigest{Sha256: digestOf([]byte("bar")).Sha256, Size: 3}, "foo", true},
+		{"without digest", stateDigest{}, "foo", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.digest.verify([]byte(c.content))
+			if c.corrupt && !errors.Is(err, ErrStateCorrupt) {
+				t.Errorf("expected corrupt state but got %v", err)
+			}
+			if !c.corrupt && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestTimedAttachmentReference_extractIfPossibleFrom(t *testing.T) {
+	const revision = "2024-01-02T03-04-05.000006"
+	foo := digestOf([]byte("foo"))
+	cases := []struct {
+		name        string
+		fileName    string
+		prefix      string
+		ok          bool
+		digest      stateDigest
+		compression StateCompression
+		chunked     bool
+	}{
+		{"with digest", "terraform-state-" + revision + foo.fileNameSuffix() + ".json", "", true, foo, StateCompressionNone, false},
+		{"without digest", "terraform-state-" + revision + ".json", "", true, stateDigest{}, StateCompressionNone, false},
+		{"gzip", "terraform-state-" + revision + foo.fileNameSuffix() + ".json.gz", "", true, foo, StateCompressionGzip, false},
+		{"zstd", "terraform-state-" + revision + foo.fileNameSuffix() + ".json.zst", "", true, foo, StateCompressionZstd, false},
+		{"manifest", "terraform-state-" + revision + foo.fileNameSuffix() + ".manifest.json", "", true, foo, StateCompressionNone, true},
+		{"prefixed", "dev.terraform-state-" + revision + foo.fileNameSuffix() + ".json", "dev.", true, foo, StateCompressionNone, false},
+		{"other prefix", "dev.terraform-state-" + revision + foo.fileNameSuffix() + ".json", "prod.", false, stateDigest{}, "", false},
+		{"prefix missing", "terraform-state-" + revision + ".json", "dev.", false, stateDigest{}, "", false},
+		{"digest without size", "terraform-state-" + revision + ".sha256-" + foo.Sha256 + ".json", "", false, stateDigest{}, "", false},
+		{"short digest", "terraform-state-" + revision + ".sha256-2c26b4.size-3.json", "", false, stateDigest{}, "", false},
+		{"upper case digest", "terraform-state-" + revision + ".sha256-2C26B46B68FFC68FF99B453C1D30413413422D706483BFA0F98A5E886266E7AE.size-3.json", "", false, stateDigest{}, "", false},
+		{"negative size", "terraform-state-" + revision + ".sha256-" + foo.Sha256 + ".size--3.json", "", false, stateDigest{}, "", false},
+		{"part", "terraform-state-" + revision + ".part-0001", "", false, stateDigest{}, "", false},
+		{"metadata", "terraform-state-" + revision + ".meta.json", "", false, stateDigest{}, "", false},
+		{"lock", lockAttachmentFileName, "", false, stateDigest{}, "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var actual timedAttachmentReference
+			ok := actual.extractIfPossibleFrom(bitwarden.ItemAttachmentReference{Id: "a", FileName: c.fileName}, c.prefix)
+			if ok != c.ok {
+				t.Fatalf("expected %v but got %v for %s", c.ok, ok, c.fileName)
+			}
+			if !ok {
+				return
+			}
+			if actual.revision() != revision {
+				t.Errorf("expected revision %s but got %s", revision, actual.revision())
+			}
+			if actual.digest != c.digest {
+				t.Errorf("expected digest %+v but got %+v", c.digest, actual.digest)
+			}
+			if actual.compression != c.compression {
+				t.Errorf("expected compression %s but got %s", c.compression, actual.compression)
+			}
+			if actual.chunked != c.chunked {
+				t.Errorf("expected chunked=%v but got %v", c.chunked, actual.chunked)
+			}
+		})
+	}
+}
+
+func TestStore_GetState_verifiesDigest(t *testing.T) {
+	s := newFakeVaultClients(t, ConfigState{MaxRevisions: 5}, 1)[0]
+	sb, _ := s.Bitwarden()
+	if err := s.PutState(concurrencyTestRef, concurrencyTestState(1, 0), nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// A newer revision whose content does not match the digest in its name.
+	item, err := s.getItem(sb, concurrencyTestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := json.Marshal(concurrencyTestState(2, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered, err := json.Marshal(concurrencyTestState(2, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "terraform-state-" + time.Now().UTC().Add(time.Hour).Format(storeAttachmentFileTimePattern) + digestOf(expected).fileNameSuffix() + ".json"
+	if err := s.createAttachment(sb, item, name, tampered); err != nil {
+		t.Fatal(err)
+	}
+
+	revs, err := s.stateRevisionsOf(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 2 || revs[0].attachment.FileName != name {
+		t.Fatalf("expected the tampered revision to be the newest but got %v", revs)
+	}
+	if _, err := s.readStateRevision(sb, item, revs[0]); !errors.Is(err, ErrStateCorrupt) {
+		t.Fatalf("expected corrupt state but got %v", err)
+	}
+
+	// Reading the state falls back to the previous good revision.
+	state, _, err := s.GetState(concurrencyTestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state["client"] != float64(0) {
+		t.Errorf("expected state of the previous revision but got %v", state)
+	}
+}
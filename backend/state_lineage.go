@@ -0,0 +1,106 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/echocat/slf4g"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+)
+
+var (
+	// ErrStateConflict is returned if a state should replace another one it
+	// does not succeed (different lineage or lower serial).
+	ErrStateConflict = errors.New("state conflict")
+)
+
+func stateSerialOf(state map[string]interface{}) int64 {
+	switch v := state["serial"].(type) {
+	case float64:
+		return int64(v)
+	case json.Number:
+		result, _ := v.Int64()
+		return result
+	default:
+		return 0
+	}
+}
+
+func stateLineageOf(state map[string]interface{}) string {
+	v, _ := state["lineage"].(string)
+	return v
+}
+
+// StateConflictError is returned if a state should replace another one it
+// does not succeed. It unwraps to ErrStateConflict.
+type StateConflictError struct {
+	Lineage       string
+	StoredLineage string
+	Serial        int64
+	StoredSerial  int64
+}
+
+func (this *StateConflictError) Error() string {
+	if this.Lineage != this.StoredLineage {
+		return fmt.Sprintf("%v: lineage %s of the new state does not match lineage %s of the stored state", ErrStateConflict, this.Lineage, this.StoredLineage)
+	}
+	return fmt.Sprintf("%v: serial %d of the new state is lower than serial %d of the stored state", ErrStateConflict, this.Serial, this.StoredSerial)
+}
+
+func (this *StateConflictError) Unwrap() error {
+	return ErrStateConflict
+}
+
+// validateStateSuccession ensures that next is a valid successor of previous:
+// both have to share the same lineage and next must not have a lower serial.
+func validateStateSuccession(previous, next map[string]interface{}) error {
+	if previous == nil {
+		return nil
+	}
+	result := StateConflictError{
+		Lineage:       stateLineageOf(next),
+		StoredLineage: stateLineageOf(previous),
+		Serial:        stateSerialOf(next),
+		StoredSerial:  stateSerialOf(previous),
+	}
+	if result.Lineage != "" && result.StoredLineage != "" && result.Lineage != result.StoredLineage {
+		return &result
+	}
+	// Lineages are only compared if both are present.
+	result.Lineage = result.StoredLineage
+	if result.Serial < result.StoredSerial {
+		return &result
+	}
+	return nil
+}
+
+// StateConflictPolicy can be implemented by a StoreParent to accept states
+// which do not succeed the stored one.
+type StateConflictPolicy interface {
+	IgnoreStateConflicts() bool
+}
+
+// validateStateSuccession ensures that the given state succeeds the latest
+// stored revision.
+func (this *Store) validateStateSuccession(b *bitwarden.Bitwarden, item *bitwarden.Item, revs stateRevisions, state map[string]interface{}) error {
+	if len(revs) == 0 {
+		return nil
+	}
+	previous, _, err := this.readLatestStateRevision(b, item, revs)
+	if err != nil {
+		return err
+	}
+	cErr := validateStateSuccession(previous, state)
+	if cErr == nil {
+		return nil
+	}
+
+	if policy, ok := this.StoreParent.(StateConflictPolicy); ok && policy.IgnoreStateConflicts() {
+		log.WithError(cErr).
+			With("itemName", item.Name).
+			With("itemId", item.Id).
+			Warn("Writing state although it does not succeed the stored one.")
+		return nil
+	}
+	return fmt.Errorf("cannot write state to item %v (%v): %w", item.Name, item.Id, cErr)
+}
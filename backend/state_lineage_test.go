@@ -0,0 +1,57 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestValidateStateSuccession(t *testing.T) {
+	state := func(lineage string, serial interface{}) map[string]interface{} {
+		result := map[string]interface{}{"serial": serial}
+		if lineage != "" {
+			result["lineage"] = lineage
+		}
+		return result
+	}
+
+	cases := []struct {
+		name     string
+		previous map[string]interface{}
+		next     map[string]interface{}
+		expected *StateConflictError
+	}{
+		{"first state", nil, state("a", float64(1)), nil},
+		{"higher serial", state("a", float64(1)), state("a", float64(2)), nil},
+		{"equal serial", state("a", float64(2)), state("a", float64(2)), nil},
+		{"lower serial", state("a", float64(2)), state("a", float64(1)), &StateConflictError{"a", "a", 1, 2}},
+		{"lineage change", state("a", float64(1)), state("b", float64(2)), &StateConflictError{"b", "a", 2, 1}},
+		{"lineage change with lower serial", state("a", float64(2)), state("b", float64(1)), &StateConflictError{"b", "a", 1, 2}},
+		{"new state without lineage", state("a", float64(1)), state("", float64(2)), nil},
+		{"stored state without lineage", state("", float64(1)), state("b", float64(2)), nil},
+		{"lower serial without lineage", state("", float64(2)), state("b", float64(1)), &StateConflictError{"", "", 1, 2}},
+		{"json number serial", state("a", json.Number("3")), state("a", json.Number("2")), &StateConflictError{"a", "a", 2, 3}},
+		{"missing serial", state("a", nil), state("a", float64(0)), nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateStateSuccession(c.previous, c.next)
+			if c.expected == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrStateConflict) {
+				t.Fatalf("expected state conflict but got %v", err)
+			}
+			var sce *StateConflictError
+			if !errors.As(err, &sce) {
+				t.Fatalf("expected StateConflictError but got %T", err)
+			}
+			if *sce != *c.expected {
+				t.Errorf("expected %+v but got %+v", *c.expected, *sce)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	metadataWho              = "who"
+	metadataHost             = "host"
+	metadataTerraformVersion = "terraform_version"
+	metadataGitCommit        = "git_commit"
+	metadataCommandLine      = "command_line"
+)
+
+var stateMetadataAttachmentFileRegex = regexp.MustCompile(`^terraform-state-(\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}\.\d{6})\.meta\.json$`)
+
+// newStateMetadata describes who wrote the given state from where and how.
+func newStateMetadata(state map[string]interface{}, commandLine []string) map[string]interface{} {
+	return stateMetadataOf(newRunMetadata(commandLine), state)
+}
+
+// newRunMetadata describes who writes states from where and how. It does not
+// change while the same command is running; so it has to be determined only
+// once, even if several states are written.
+func newRunMetadata(commandLine []string) map[string]interface{} {
+	who, host := currentUserAndHost()
+	result := map[string]interface{}{
+		metadataWho:  who,
+		metadataHost: host,
+	}
+	if v := currentGitCommit(); v != "" {
+		result[metadataGitCommit] = v
+	}
+	if len(commandLine) > 0 {
+		result[metadataCommandLine] = redactCommandLine(commandLine)
+	}
+	return result
+}
+
+// stateMetadataOf extends the metadata of the run by the version of Terraform
+// which wrote the given state.
+func stateMetadataOf(run map[string]interface{}, state map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(run)+1)
+	for k, v := range run {
+		result[k] = v
+	}
+	if v, ok := state["terraform_version"].(string); ok && v != "" {
+		result[metadataTerraformVersion] = v
+	}
+	return result
+}
+
+func currentGitCommit() string {
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// redactedCommandLineFlags are the flags of Terraform whose values are
+// assignments which might contain secrets.
+var redactedCommandLineFlags = []string{"var", "backend-config"}
+
+// redactCommandLine removes the values of variables passed by -var and of
+// the backend configuration passed by -backend-config (both as separate
+// argument and as -flag=value), because they might contain secrets. The same
+// applies to environment variables like TF_VAR_name=value which are part of
+// the command line.
+func redactCommandLine(args []string) string {
+	result := make([]string, len(args))
+	redactNext := false
+	for i, arg := range args {
+		if redactNext {
+			result[i] = redactVariableAssignment(arg)
+			redactNext = false
+			continue
+		}
+		result[i] = arg
+		if strings.HasPrefix(arg, "TF_VAR_") {
+			result[i] = redactVariableAssignment(arg)
+			continue
+		}
+		flag, value, withValue := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+		if !strings.HasPrefix(arg, "-") || !slices.Contains(redactedCommandLineFlags, flag) {
+			continue
+		}
+		if withValue {
+			result[i] = arg[:len(arg)-len(value)] + redactVariableAssignment(value)
+		} else {
+			redactNext = true
+		}
+	}
+	return strings.Join(result, " ")
+}
+
+// redactVariableAssignment removes the value of name=value. Everything else,
+// like the path of a file, is kept.
+func redactVariableAssignment(assignment string) string {
+	if i := strings.Index(assignment, "="); i >= 0 {
+		return assignment[:i+1] + "<redacted>"
+	}
+	return assignment
+}
+
+func metadataStringOf(metadata map[string]interface{}, key string) string {
+	if v, ok := metadata[key]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+func (this *Store) writeStateMetadataAttachment(b *bitwarden.Bitwarden, item *bitwarden.Item, at time.Time, metadata map[string]interface{}) error {
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("cannot encode metadata of state for item %v (%v): %w", item.Name, item.Id, err)
+	}
+	fn := "terraform-state-" + at.UTC().Format(storeAttachmentFileTimePattern) + ".meta.json"
+	return this.createAttachment(b, item, fn, encoded)
+}
+
+// metadataAttachmentReferencesOf returns the metadata attachments of the
+// revision at the given time. If the time is zero all metadata attachments
+// are returned.
+func (this *Store) metadataAttachmentReferencesOf(item *bitwarden.Item, at time.Time) (result bitwarden.ItemAttachmentReferences) {
+	for _, ref := range item.AttachmentReferences {
+		fn, ok := this.fileNameOf(ref)
+		if !ok {
+			continue
+		}
+		m := stateMetadataAttachmentFileRegex.FindStringSubmatch(fn)
+		if m == nil {
+			continue
+		}
+		if at.IsZero() || m[1] == at.Format(storeAttachmentFileTimePattern) {
+			result = append(result, ref)
+		}
+	}
+	return
+}
+
+// readStateMetadata returns the metadata of the given revision or nil if the
+// revision was written without metadata.
+func (this *Store) readStateMetadata(b *bitwarden.Bitwarden, item *bitwarden.Item, rev stateRevision) (map[string]interface{}, error) {
+	if rev.notes != nil {
+		return rev.notes.Metadata, nil
+	}
+
+	refs := this.metadataAttachmentReferencesOf(item, rev.time)
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	content, err := b.GetAttachmentContent(*item, refs[0].Id)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{}
+	if err := json.Unmarshal(content, &result); err != nil {
+		return nil, fmt.Errorf("cannot decode metadata of revision %s of item %v (%v): %w", rev.revision(), item.Name, item.Id, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package backend
+
+import (
+	"testing"
+)
+
+func TestRedactCommandLine(t *testing.T) {
+	cases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"without secrets", []string{"terraform", "apply", "-auto-approve"}, "terraform apply -auto-approve"},
+		{"var", []string{"terraform", "apply", "-var", "password=secret"}, "terraform apply -var password=<redacted>"},
+		{"var with double dash", []string{"terraform", "apply", "--var", "password=secret"}, "terraform apply --var password=<redacted>"},
+		{"var with equals", []string{"terraform", "apply", "-var=password=secret"}, "terraform apply -var=password=<redacted>"},
+		{"var with double dash and equals", []string{"terraform", "apply", "--var=password=a=b"}, "terraform apply --var=password=<redacted>"},
+		{"backend config", []string{"terraform", "init", "-backend-config", "token=secret"}, "terraform init -backend-config token=<redacted>"},
+		{"backend config with equals", []string{"terraform", "init", "-backend-config=token=secret"}, "terraform init -backend-config=token=<redacted>"},
+		{"backend config file", []string{"terraform", "init", "-backend-config=backend.hcl"}, "terraform init -backend-config=backend.hcl"},
+		{"var file", []string{"terraform", "apply", "-var-file=secret.tfvars"}, "terraform apply -var-file=secret.tfvars"},
+		{"environment variable", []string{"TF_VAR_password=secret", "terraform", "apply"}, "TF_VAR_password=<redacted> terraform apply"},
+		{"several", []string{"terraform", "apply", "-var", "a=1", "-var=b=2", "c=3"}, "terraform apply -var a=<redacted> -var=b=<redacted> c=3"},
+		{"flag as last argument", []string{"terraform", "apply", "-var"}, "terraform apply -var"},
+		{"value looking like a flag", []string{"terraform", "apply", "-var", "-var=x"}, "terraform apply -var -var=<redacted>"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := redactCommandLine(c.args); actual != c.expected {
+				t.Errorf("expected %q but got %q", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestBackend_getMetaDataHook_commandLine(t *testing.T) {
+	cases := []struct {
+		name     string
+		serving  bool
+		expected string
+	}{
+		{"running terraform", false, "terraform apply -var a=<redacted>"},
+		{"serving", true, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			backend := &Backend{
+				TerraformArgs: []string{"apply", "-var", "a=secret"},
+				config:        NewConfig(),
+				serving:       c.serving,
+			}
+			metadata := backend.getMetaDataHook(map[string]interface{}{"terraform_version": "1.9.0"})
+			if actual := metadataStringOf(metadata, metadataCommandLine); actual != c.expected {
+				t.Errorf("expected command line %q but got %q", c.expected, actual)
+			}
+			if actual := metadataStringOf(metadata, metadataTerraformVersion); actual != "1.9.0" {
+				t.Errorf("expected terraform version 1.9.0 but got %q", actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/echocat/slf4g"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"sort"
+	"time"
+)
+
+// stateRevision is one stored revision of a state, either stored as
+// attachment or inside of the notes of an item.
+type stateRevision struct {
+	time       time.Time
+	attachment *timedAttachmentReference
+	notes      *notesRevision
+}
+
+func (this stateRevision) revision() string {
+	return this.time.Format(storeAttachmentFileTimePattern)
+}
+
+func (this stateRevision) storage() StateStorage {
+	if this.notes != nil {
+		return StateStorageNotes
+	}
+	return StateStorageAttachment
+}
+
+// size returns a human readable size of the stored revision. For chunked
+// attachments this is the size of the manifest only.
+func (this stateRevision) size() string {
+	if this.notes != nil {
+		return fmt.Sprintf("%d bytes", len(this.notes.State))
+	}
+	if v, err := this.attachment.SizeInBytes(); err == nil && v > 0 {
+		return fmt.Sprintf("%d bytes", v)
+	}
+	return "unknown size"
+}
+
+type stateRevisions []stateRevision
+
+func (this stateRevisions) lookup(revision string) *stateRevision {
+	for i, candidate := range this {
+		if candidate.revision() == revision {
+			return &this[i]
+		}
+	}
+	return nil
+}
+
+func (a stateRevisions) Less(i, j int) bool {
+	return a[i].time.After(a[j].time)
+}
+
+func (a stateRevisions) Len() int      { return len(a) }
+func (a stateRevisions) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+
+// stateRevisionsOf returns all revisions of the given item, the newest first.
+func (this *Store) stateRevisionsOf(item *bitwarden.Item) (stateRevisions, error) {
+	var result stateRevisions
+
+	var arefs timedAttachmentReferences
+	arefs.extractIfPossibleFrom(&item.AttachmentReferences, this.attachmentPrefix)
+	for i, aref := range arefs {
+		result = append(result, stateRevision{time: aref.time, attachment: &arefs[i]})
+	}
+
+	if this.hasNotesDocument(item) {
+		doc, err := this.readNotesDocument(item)
+		if err != nil {
+			return nil, err
+		}
+		for i, nrev := range doc.Revisions {
+			result = append(result, stateRevision{time: nrev.Time, notes: &doc.Revisions[i]})
+		}
+	}
+
+	sort.Sort(result)
+	return result, nil
+}
+
+func (this stateRevision) digest() stateDigest {
+	if this.notes != nil {
+		return stateDigest{Sha256: this.notes.Sha256, Size: this.notes.Size}
+	}
+	return this.attachment.digest
+}
+
+func (this *Store) readStateRevision(b *bitwarden.Bitwarden, item *bitwarden.Item, rev stateRevision) (map[string]interface{}, error) {
+	var content []byte
+	if rev.attachment != nil {
+		var err error
+		if content, err = this.readStateAttachments(b, item, rev.attachment); err != nil {
+			return nil, err
+		}
+	} else {
+		content = rev.notes.State
+	}
+
+	if err := rev.digest().verify(content); err != nil {
+		return nil, fmt.Errorf("state of revision %s of item %v (%v) is corrupt: %w", rev.revision(), item.Name, item.Id, err)
+	}
+
+	state := map[string]interface{}{}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("%w: cannot decode state of revision %s of item %v (%v): %v", ErrStateCorrupt, rev.revision(), item.Name, item.Id, err)
+	}
+	return state, nil
+}
+
+// readLatestStateRevision returns the newest revision which can be read. If
+// the newest is corrupt, the previous ones are tried. If none can be read, the
+// error of the newest is returned.
+func (this *Store) readLatestStateRevision(b *bitwarden.Bitwarden, item *bitwarden.Item, revs stateRevisions) (map[string]interface{}, *stateRevision, error) {
+	var firstErr error
+	for i, rev := range revs {
+		state, err := this.readStateRevision(b, item, rev)
+		if err == nil {
+			if i > 0 {
+				log.WithError(firstErr).
+					With("itemName", item.Name).
+					With("itemId", item.Id).
+					With("revision", rev.revision()).
+					With("skippedRevisions", i).
+					Error("!!! The latest revision of the state cannot be read; falling back to the previous good revision. Check the state carefully before applying any changes. !!!")
+			}
+			return state, &revs[i], nil
+		}
+		if !errors.Is(err, ErrStateCorrupt) {
+			return nil, nil, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, nil, firstErr
+}
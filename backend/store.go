@@ -6,9 +6,10 @@ import (
 	"fmt"
 	"github.com/bhoriuchi/terraform-backend-http/go/store"
 	"github.com/bhoriuchi/terraform-backend-http/go/types"
+	log "github.com/echocat/slf4g"
 	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
 	"regexp"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -23,12 +24,40 @@ type StoreParent interface {
 
 type Store struct {
 	StoreParent
+
+	// attachmentPrefix is prepended to the names of all attachments and
+	// hidden fields of a workspace which shares its item with other
+	// workspaces. See ConfigState.WorkspaceAttachmentPrefix.
+	attachmentPrefix string
 }
 
 func (this *Store) Init() error {
 	return nil
 }
 
+// scopedTo returns a store which only handles the attachments and fields of
+// the workspace the given reference points to.
+func (this *Store) scopedTo(plainRef string) *Store {
+	ref, _ := NewStoreRef(plainRef)
+	if ref.AttachmentPrefix == this.attachmentPrefix {
+		return this
+	}
+	return &Store{StoreParent: this.StoreParent, attachmentPrefix: ref.AttachmentPrefix}
+}
+
+// prefixed returns the name of the attachment or hidden field with the given
+// name inside of the scope of this store.
+func (this *Store) prefixed(name string) string {
+	return this.attachmentPrefix + name
+}
+
+// fileNameOf returns the name of the given attachment without the prefix of
+// this store. If it does not belong to the scope of this store, false is
+// returned.
+func (this *Store) fileNameOf(ref bitwarden.ItemAttachmentReference) (string, bool) {
+	return strings.CutPrefix(ref.FileName, this.attachmentPrefix)
+}
+
 func (this *Store) getItem(b *bitwarden.Bitwarden, plainRef string) (*bitwarden.Item, error) {
 	ref, err := NewStoreRef(plainRef)
 	if err != nil {
@@ -43,17 +72,164 @@ func (this *Store) getItem(b *bitwarden.Bitwarden, plainRef string) (*bitwarden.
 		return b.GetItem(ref.ItemId, nil)
 	}
 	if ref.ItemName != "" {
+		folderId, collectionId, err := this.itemScopeOf(b)
+		if err != nil {
+			return nil, err
+		}
 		return b.FindItem(bitwarden.ItemQuery{
 			Name:           ref.ItemName,
 			OrganizationId: this.GetOrganizationId(),
-			CollectionId:   this.GetCollectionId(),
-			FolderId:       this.GetFolderId(),
+			CollectionId:   collectionId,
+			FolderId:       folderId,
+			OnAmbiguity:    this.GetConfig().GetState().AmbiguityPolicy,
 		})
 	}
 	return nil, fmt.Errorf("%w: %s", ErrIllegalStoreRef, plainRef)
 }
 
+// itemScopeOf returns the folder and collection items are searched in. If
+// they are configured by name they are resolved (but not created). If one of
+// them does not exist yet, ErrNoSuchItem is returned, because no item can
+// exist inside of it.
+func (this *Store) itemScopeOf(b *bitwarden.Bitwarden) (folderId, collectionId string, err error) {
+	sc := this.GetConfig().GetState()
+
+	folderId = this.GetFolderId()
+	if folderId == "" && sc.FolderName != "" {
+		folder, err := b.FindFolder(sc.FolderName)
+		if errors.Is(err, bitwarden.ErrNoSuchFolder) {
+			return "", "", bitwarden.ErrNoSuchItem
+		}
+		if err != nil {
+			return "", "", err
+		}
+		folderId = folder.Id
+	}
+
+	collectionId = this.GetCollectionId()
+	if collectionId == "" && sc.CollectionName != "" {
+		collection, err := b.FindCollection(sc.OrganizationId, sc.CollectionName)
+		if errors.Is(err, bitwarden.ErrNoSuchCollection) {
+			return "", "", bitwarden.ErrNoSuchItem
+		}
+		if err != nil {
+			return "", "", err
+		}
+		collectionId = collection.Id
+	}
+
+	return folderId, collectionId, nil
+}
+
+// getOrCreateItem returns the item of the given reference. If it does not
+// exist and create_if_missing is enabled, it will be created.
+func (this *Store) getOrCreateItem(b *bitwarden.Bitwarden, plainRef string) (*bitwarden.Item, error) {
+	item, err := this.getItem(b, plainRef)
+	if err != bitwarden.ErrNoSuchItem || !this.GetConfig().GetState().IsCreateIfMissing() {
+		return item, err
+	}
+
+	item, err = this.createItem(b, plainRef)
+	if err != nil {
+		return nil, err
+	}
+	log.With("itemName", item.Name).
+		With("itemId", item.Id).
+		Info("Item for state did not exist and was created.")
+
+	return item, nil
+}
+
+// createItem creates a new empty secure note for the given reference inside
+// of the configured organization, collection and folder. Folder and
+// collection configured by name are created if they do not exist yet.
+func (this *Store) createItem(b *bitwarden.Bitwarden, plainRef string) (*bitwarden.Item, error) {
+	ref, err := NewStoreRef(plainRef)
+	if err != nil {
+		return nil, err
+	}
+	if ref.ItemName == "" {
+		return nil, fmt.Errorf("%w: items can only be created by name: %s", ErrIllegalStoreRef, plainRef)
+	}
+	sc := this.GetConfig().GetState()
+
+	nv := bitwarden.Item{
+		Type: bitwarden.ItemTypeSecureNote,
+		Name: ref.ItemName,
+	}
+	if v := this.GetOrganizationId(); v != "" {
+		nv.OrganizationId = &v
+	}
+	if v := this.GetFolderId(); v != "" {
+		nv.FolderId = &v
+	} else if v := sc.FolderName; v != "" {
+		folder, err := this.getOrCreateFolder(b, v)
+		if err != nil {
+			return nil, err
+		}
+		nv.FolderId = &folder.Id
+	}
+	if v := this.GetCollectionId(); v != "" {
+		nv.CollectionIds = []string{v}
+	} else if v := sc.CollectionName; v != "" {
+		collection, err := this.getOrCreateCollection(b, sc.OrganizationId, v)
+		if err != nil {
+			return nil, err
+		}
+		nv.CollectionIds = []string{collection.Id}
+	}
+
+	created, err := b.CreateItem(nv)
+	if err != nil {
+		return nil, err
+	}
+
+	if sc.IsRecordItemId() && ref.ItemName == sc.ItemName {
+		if ok, err := recordStateItemId(created.Id); err != nil {
+			log.WithError(err).
+				With("itemId", created.Id).
+				Warn("Cannot record ID of the created item in the local configuration.")
+		} else if ok {
+			log.With("itemId", created.Id).
+				With("file", localConfigFile).
+				Info("Recorded ID of the created item in the local configuration.")
+		}
+	}
+
+	return created, nil
+}
+
+func (this *Store) getOrCreateFolder(b *bitwarden.Bitwarden, name string) (*bitwarden.Folder, error) {
+	folder, err := b.FindFolder(name)
+	if !errors.Is(err, bitwarden.ErrNoSuchFolder) {
+		return folder, err
+	}
+	if folder, err = b.CreateFolder(name); err != nil {
+		return nil, err
+	}
+	log.With("folderName", folder.Name).
+		With("folderId", folder.Id).
+		Info("Folder for state did not exist and was created.")
+	return folder, nil
+}
+
+func (this *Store) getOrCreateCollection(b *bitwarden.Bitwarden, organizationId, name string) (*bitwarden.Collection, error) {
+	collection, err := b.FindCollection(organizationId, name)
+	if !errors.Is(err, bitwarden.ErrNoSuchCollection) {
+		return collection, err
+	}
+	if collection, err = b.CreateCollection(organizationId, name); err != nil {
+		return nil, err
+	}
+	log.With("collectionName", collection.Name).
+		With("collectionId", collection.Id).
+		With("organizationId", collection.OrganizationId).
+		Info("Collection for state did not exist and was created.")
+	return collection, nil
+}
+
 func (this *Store) GetState(plainRef string) (state map[string]interface{}, encrypted bool, err error) {
+	this = this.scopedTo(plainRef)
 	b, err := this.Bitwarden()
 	if err != nil {
 		return nil, false, err
@@ -67,21 +243,17 @@ func (this *Store) GetState(plainRef string) (state map[string]interface{}, encr
 		return nil, false, err
 	}
 
-	aref := this.latestAttachmentReferenceOf(item)
-	if aref == nil {
-		return nil, false, store.ErrNotFound
-	}
-
-	attachment, err := b.GetAttachment(*item, aref.Id, false)
+	revs, err := this.stateRevisionsOf(item)
 	if err != nil {
 		return nil, false, err
 	}
-
-	state = map[string]interface{}{}
-	if err := json.Unmarshal([]byte(attachment), &state); err != nil {
-		return nil, false, fmt.Errorf("cannot decode state of attachment %s of item %v (%v)", aref.FileName, item.Name, item.Id)
+	if len(revs) == 0 {
+		return nil, false, store.ErrNotFound
 	}
 
+	if state, _, err = this.readLatestStateRevision(b, item, revs); err != nil {
+		return nil, false, err
+	}
 	return state, false, nil
 }
 
@@ -89,10 +261,7 @@ func (this *Store) PutState(plainRef string, state, metadata map[string]interfac
 	if encrypted {
 		return fmt.Errorf("encryption of states are not supported, because inside of Bitwarden it is already encrypted")
 	}
-	if len(metadata) > 0 {
-		return fmt.Errorf("currently there are no metadata supported")
-	}
-
+	this = this.scopedTo(plainRef)
 	encoded, err := json.Marshal(state)
 	if err != nil {
 		return err
@@ -103,26 +272,67 @@ func (this *Store) PutState(plainRef string, state, metadata map[string]interfac
 		return err
 	}
 
-	item, err := this.getItem(b, plainRef)
+	return this.retryOnConcurrentModification(plainRef, func() error {
+		return this.putState(b, plainRef, state, metadata, encoded)
+	})
+}
+
+func (this *Store) putState(b *bitwarden.Bitwarden, plainRef string, state, metadata map[string]interface{}, encoded []byte) error {
+	item, err := this.getOrCreateItem(b, plainRef)
 	if err != nil {
 		return err
 	}
 
-	fn := this.newStateFilename()
-
-	if err := b.CreateAttachment(*item, fn, encoded); err != nil {
+	revs, err := this.stateRevisionsOf(item)
+	if err != nil {
+		return err
+	}
+	if err := this.validateStateSuccession(b, item, revs, state); err != nil {
 		return err
 	}
 
-	var arefs timedAttachmentReferences
-	arefs.extractIfPossibleFrom(&item.AttachmentReferences)
+	now := time.Now().UTC()
+	expired := this.expiredRevisionsOf(revs, now)
 
-	maxHistory := this.GetConfig().GetState().GetMaxRevisions() - 1 // 1 = the item we just added
-	if len(arefs) > int(maxHistory) {
-		sort.Sort(sort.Reverse(arefs))
+	writtenToNotes := false
+	if this.GetConfig().GetState().GetStorage() == StateStorageNotes {
+		if ok, err := this.putStateIntoNotes(b, item, encoded, metadata, now, expired); errors.Is(err, ErrForeignNotes) {
+			log.WithError(err).
+				With("itemName", item.Name).
+				With("itemId", item.Id).
+				Warn("Notes cannot be used as state storage; falling back to attachments.")
+		} else if err != nil {
+			return err
+		} else if ok {
+			writtenToNotes = true
+		} else {
+			log.With("itemName", item.Name).
+				With("itemId", item.Id).
+				With("size", len(encoded)).
+				Warn("State does not fit into the notes next to the revisions to keep; falling back to attachments.")
+		}
+	}
 
-		for _, aref := range arefs[:maxHistory] {
-			if err := b.DeleteAttachment(*item, *aref.ItemAttachmentReference); err != nil {
+	if !writtenToNotes {
+		if err := this.writeStateAttachments(b, item, now, encoded); err != nil {
+			return err
+		}
+		if len(metadata) > 0 {
+			if err := this.writeStateMetadataAttachment(b, item, now, metadata); err != nil {
+				log.WithError(err).
+					With("itemName", item.Name).
+					With("itemId", item.Id).
+					Warn("State was written but its metadata could not be stored.")
+			}
+		}
+		if err := this.deleteRevisionsFromNotes(b, item, expired); err != nil {
+			return err
+		}
+	}
+
+	for _, rev := range expired {
+		if rev.attachment != nil {
+			if err := this.deleteStateAttachments(b, item, rev.attachment); err != nil {
 				return err
 			}
 		}
@@ -132,6 +342,7 @@ func (this *Store) PutState(plainRef string, state, metadata map[string]interfac
 }
 
 func (this *Store) DeleteState(plainRef string) error {
+	this = this.scopedTo(plainRef)
 	b, err := this.Bitwarden()
 	if err != nil {
 		return err
@@ -143,60 +354,127 @@ func (this *Store) DeleteState(plainRef string) error {
 	}
 
 	var arefs timedAttachmentReferences
-	arefs.extractIfPossibleFrom(&item.AttachmentReferences)
+	arefs.extractIfPossibleFrom(&item.AttachmentReferences, this.attachmentPrefix)
 
 	for _, aref := range arefs {
-		if err := b.DeleteAttachment(*item, *aref.ItemAttachmentReference); err != nil {
+		if err := this.deleteAttachment(b, item, *aref.ItemAttachmentReference); err != nil {
+			return err
+		}
+	}
+	// This includes also parts of incomplete uploads without a manifest.
+	for _, ref := range append(this.partAttachmentReferencesOf(item, time.Time{}), this.metadataAttachmentReferencesOf(item, time.Time{})...) {
+		if err := this.deleteAttachment(b, item, ref); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return this.deleteStatesFromNotes(b, item)
 }
 
 func (this *Store) GetLock(plainRef string) (*types.Lock, error) {
+	this = this.scopedTo(plainRef)
 	b, err := this.Bitwarden()
 	if err != nil {
 		return nil, err
 	}
 
 	item, err := this.getItem(b, plainRef)
+	if err == bitwarden.ErrNoSuchItem && this.GetConfig().GetState().IsCreateIfMissing() {
+		// The item will be created by PutLock.
+		return nil, store.ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	for _, aref := range item.AttachmentReferences {
-		if aref.FileName == lockAttachmentFileName {
-			attachment, err := b.GetAttachment(*item, aref.Id, false)
-			if err != nil {
-				return nil, err
-			}
-
-			buf := types.Lock{}
-			if err := json.Unmarshal([]byte(attachment), &buf); err != nil {
-				return nil, fmt.Errorf("cannot decode lock of attachment %s of item %v (%v)", aref.FileName, item.Name, item.Id)
-			}
+	lock, err := this.getLock(b, item)
+	if err != nil {
+		return nil, err
+	}
+	if ttl := this.GetConfig().GetState().GetLockTtl(); lock.isExpired(ttl) {
+		log.With("itemName", item.Name).
+			With("itemId", item.Id).
+			With("lockId", lock.ID).
+			With("who", lock.Who).
+			With("lastSeen", lock.lastSeen()).
+			Warn("Ignoring expired lock.")
+		return nil, store.ErrNotFound
+	}
+	return &lock.Lock, nil
+}
 
-			return &buf, nil
+// getLock returns the current lock of the item, regardless if it is expired.
+func (this *Store) getLock(b *bitwarden.Bitwarden, item *bitwarden.Item) (*storedLock, error) {
+	locks, err := this.lockAttachmentsOf(b, item)
+	if err != nil {
+		return nil, err
+	}
+	if len(locks) > 0 {
+		result := locks[0].lock
+		if err := this.applyLockHeartbeat(item, &result); err != nil {
+			return nil, err
 		}
+		return &result, nil
 	}
+
+	if lock, err := this.getLockFromNotes(item); err != nil {
+		return nil, err
+	} else if lock != nil {
+		return lock, nil
+	}
+
 	return nil, store.ErrNotFound
 }
 
 func (this *Store) PutLock(plainRef string, lock types.Lock) error {
+	this = this.scopedTo(plainRef)
 	b, err := this.Bitwarden()
 	if err != nil {
 		return err
 	}
 
-	item, err := this.getItem(b, plainRef)
+	return this.retryOnConcurrentModification(plainRef, func() error {
+		now := time.Now().UTC()
+		return this.putLock(b, plainRef, storedLock{Lock: lock, Heartbeat: &now})
+	})
+}
+
+// putLock writes the given lock, unless the state is locked by someone else
+// who has not given up the lock yet.
+func (this *Store) putLock(b *bitwarden.Bitwarden, plainRef string, lock storedLock) error {
+	item, err := this.getOrCreateItem(b, plainRef)
 	if err != nil {
 		return err
 	}
 
+	if current, err := this.getLock(b, item); err == nil {
+		if current.ID != lock.ID && !current.isExpired(this.GetConfig().GetState().GetLockTtl()) {
+			return &LockHeldError{current.Lock}
+		}
+	} else if err != store.ErrNotFound {
+		return err
+	}
+
+	if this.GetConfig().GetState().GetStorage() == StateStorageNotes {
+		if ok, err := this.putLockIntoNotes(b, item, &lock); errors.Is(err, ErrForeignNotes) {
+			log.WithError(err).
+				With("itemName", item.Name).
+				With("itemId", item.Id).
+				Warn("Notes cannot be used to store the lock; falling back to attachments.")
+		} else if err != nil {
+			return err
+		} else if ok {
+			return nil
+		} else {
+			log.With("itemName", item.Name).
+				With("itemId", item.Id).
+				Warn("Lock does not fit into the notes anymore; falling back to attachments.")
+		}
+	}
+
 	var attachmentsToDelete []bitwarden.ItemAttachmentReference
 	for _, aref := range item.AttachmentReferences {
-		if aref.FileName == lockAttachmentFileName {
+		if fn, ok := this.fileNameOf(aref); ok && fn == lockAttachmentFileName {
 			attachmentsToDelete = append(attachmentsToDelete, aref)
 		}
 	}
@@ -206,12 +484,12 @@ func (this *Store) PutLock(plainRef string, lock types.Lock) error {
 		return fmt.Errorf("cannot encode lock for item %v (%v)", item.Name, item.Id)
 	}
 
-	if err := b.CreateAttachment(*item, lockAttachmentFileName, buf); err != nil {
+	if err := this.createAttachment(b, item, lockAttachmentFileName, buf); err != nil {
 		return err
 	}
 
 	for _, aref := range attachmentsToDelete {
-		if err := b.DeleteAttachment(*item, aref); err != nil {
+		if err := this.deleteAttachment(b, item, aref); err != nil {
 			return err
 		}
 	}
@@ -219,57 +497,103 @@ func (this *Store) PutLock(plainRef string, lock types.Lock) error {
 	return nil
 }
 
+// DeleteLock deletes the lock regardless who holds it. Use DeleteLockOf to
+// ensure that only the own lock will be deleted.
 func (this *Store) DeleteLock(plainRef string) error {
+	return this.DeleteLockOf(plainRef, "")
+}
+
+// DeleteLockOf deletes the lock only if it has the given ID. Otherwise a
+// LockHeldError is returned. An empty ID matches every lock.
+func (this *Store) DeleteLockOf(plainRef string, id string) error {
+	this = this.scopedTo(plainRef)
 	b, err := this.Bitwarden()
 	if err != nil {
 		return err
 	}
 
+	return this.retryOnConcurrentModification(plainRef, func() error {
+		return this.deleteLock(b, plainRef, id)
+	})
+}
+
+func (this *Store) deleteLock(b *bitwarden.Bitwarden, plainRef string, id string) error {
 	item, err := this.getItem(b, plainRef)
 	if err != nil {
 		return err
 	}
 
+	if id != "" {
+		current, err := this.getLock(b, item)
+		if err == store.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if current.ID != id {
+			return &LockHeldError{current.Lock}
+		}
+	}
+
 	for _, aref := range item.AttachmentReferences {
-		if aref.FileName == lockAttachmentFileName {
-			if err := b.DeleteAttachment(*item, aref); err != nil {
+		if fn, ok := this.fileNameOf(aref); ok && fn == lockAttachmentFileName {
+			if err := this.deleteAttachment(b, item, aref); err != nil {
 				return err
 			}
 		}
 	}
 
+	if heartbeat, err := this.lockHeartbeatOf(item); err != nil {
+		return err
+	} else if heartbeat != nil {
+		if err := this.setHiddenField(b, item, lockHeartbeatFieldName, ""); err != nil {
+			return err
+		}
+	}
+
+	if lock, err := this.getLockFromNotes(item); err != nil {
+		return err
+	} else if lock != nil {
+		_, err := this.putLockIntoNotes(b, item, nil)
+		return err
+	}
+
 	return nil
 }
 
 const storeAttachmentFileTimePattern = "2006-01-02T15-04-05.000000"
 const lockAttachmentFileName = "terraform.lock.json"
 
-var stateAttachmentFileRegex = regexp.MustCompile(`^terraform-state-(\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}\.\d{6})\.json$`)
+var stateAttachmentFileRegex = regexp.MustCompile(`^terraform-state-(\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}\.\d{6})(?:\.sha256-([0-9a-f]{64})\.size-(\d+))?\.(?:json(\.gz|\.zst)?|(manifest)\.json)$`)
 
-func (this *Store) latestAttachmentReferenceOf(item *bitwarden.Item) (result *timedAttachmentReference) {
-	if item != nil {
-		var refs timedAttachmentReferences
-		refs.extractIfPossibleFrom(&item.AttachmentReferences)
-		sort.Sort(refs)
-		if len(refs) > 0 {
-			result = &refs[0]
-		}
-	}
-	return
+// isStoreAttachmentFileName returns true if the given name (without any
+// attachment prefix) is one of the attachments written by the store.
+func isStoreAttachmentFileName(fn string) bool {
+	return fn == lockAttachmentFileName ||
+		stateAttachmentFileRegex.MatchString(fn) ||
+		statePartAttachmentFileRegex.MatchString(fn) ||
+		stateMetadataAttachmentFileRegex.MatchString(fn)
 }
 
 type timedAttachmentReference struct {
-	time time.Time
+	time        time.Time
+	digest      stateDigest
+	compression StateCompression
+	chunked     bool
 	*bitwarden.ItemAttachmentReference
 }
 
-func (this *Store) newStateFilename() string {
-	t := time.Now().UTC().Format(storeAttachmentFileTimePattern)
-	return "terraform-state-" + t + ".json"
+func (this timedAttachmentReference) revision() string {
+	return this.time.Format(storeAttachmentFileTimePattern)
 }
 
-func (this *timedAttachmentReference) extractIfPossibleFrom(ref bitwarden.ItemAttachmentReference) bool {
-	m := stateAttachmentFileRegex.FindStringSubmatch(ref.FileName)
+func (this *timedAttachmentReference) extractIfPossibleFrom(ref bitwarden.ItemAttachmentReference, prefix string) bool {
+	fn, ok := strings.CutPrefix(ref.FileName, prefix)
+	if !ok {
+		return false
+	}
+	m := stateAttachmentFileRegex.FindStringSubmatch(fn)
 	if m == nil {
 		return false
 	}
@@ -279,6 +603,14 @@ func (this *timedAttachmentReference) extractIfPossibleFrom(ref bitwarden.ItemAt
 		return false
 	}
 	this.time = parsed
+	this.digest = stateDigest{Sha256: m[2]}
+	if m[3] != "" {
+		if this.digest.Size, err = strconv.ParseInt(m[3], 10, 64); err != nil {
+			return false
+		}
+	}
+	this.compression = stateCompressionOfExtension(m[4])
+	this.chunked = m[5] != ""
 	this.ItemAttachmentReference = &ref
 
 	return true
@@ -286,12 +618,14 @@ func (this *timedAttachmentReference) extractIfPossibleFrom(ref bitwarden.ItemAt
 
 type timedAttachmentReferences []timedAttachmentReference
 
-func (this *timedAttachmentReferences) extractIfPossibleFrom(refs *bitwarden.ItemAttachmentReferences) {
+// extractIfPossibleFrom extracts all state attachments whose names start with
+// the given prefix.
+func (this *timedAttachmentReferences) extractIfPossibleFrom(refs *bitwarden.ItemAttachmentReferences, prefix string) {
 	var bufs timedAttachmentReferences
 	if refs != nil {
 		for _, ref := range *refs {
 			var buf timedAttachmentReference
-			if buf.extractIfPossibleFrom(ref) {
+			if buf.extractIfPossibleFrom(ref, prefix) {
 				bufs = append(bufs, buf)
 			}
 		}
@@ -299,13 +633,6 @@ func (this *timedAttachmentReferences) extractIfPossibleFrom(refs *bitwarden.Ite
 	*this = bufs
 }
 
-func (a timedAttachmentReferences) Less(i, j int) bool {
-	return a[i].time.After(a[j].time)
-}
-
-func (a timedAttachmentReferences) Len() int      { return len(a) }
-func (a timedAttachmentReferences) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
-
 func NewStoreRef(plain string) (StoreRef, error) {
 	var buf StoreRef
 	if err := buf.Set(plain); err != nil {
@@ -318,14 +645,28 @@ var (
 	ErrIllegalStoreRef = errors.New("illegal store ref")
 )
 
+// StoreRef references the item of a state, either by its ID or by its name.
+// If AttachmentPrefix is set the item is shared by several workspaces and
+// only the attachments with this prefix belong to the referenced state. Its
+// string representation is "[prefix:<prefix>:](id|name):<value>".
 type StoreRef struct {
-	ItemId   string
-	ItemName string
+	ItemId           string
+	ItemName         string
+	AttachmentPrefix string
 }
 
 func (this *StoreRef) Set(plain string) error {
 	var buf StoreRef
 
+	if rest, ok := strings.CutPrefix(plain, "prefix:"); ok {
+		prefix, itemRef, ok := strings.Cut(rest, ":")
+		if !ok || prefix == "" {
+			return fmt.Errorf("%w: %s", ErrIllegalStoreRef, plain)
+		}
+		buf.AttachmentPrefix = prefix
+		plain = itemRef
+	}
+
 	if plain != "" {
 		parts := strings.SplitN(plain, ":", 2)
 		if len(parts) < 2 {
@@ -347,11 +688,16 @@ func (this *StoreRef) Set(plain string) error {
 }
 
 func (this StoreRef) String() string {
+	var result string
 	if v := this.ItemId; v != "" {
-		return "id:" + v
+		result = "id:" + v
+	} else if v := this.ItemName; v != "" {
+		result = "name:" + v
+	} else {
+		return ""
 	}
-	if v := this.ItemName; v != "" {
-		return "name:" + v
+	if v := this.AttachmentPrefix; v != "" {
+		result = "prefix:" + v + ":" + result
 	}
-	return ""
+	return result
 }
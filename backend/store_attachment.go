@@ -0,0 +1,256 @@
+package backend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	log "github.com/echocat/slf4g"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"regexp"
+	"time"
+)
+
+type StateCompression string
+
+const (
+	StateCompressionNone = StateCompression("none")
+	StateCompressionGzip = StateCompression("gzip")
+	StateCompressionZstd = StateCompression("zstd")
+)
+
+func (this StateCompression) Validate() error {
+	switch this {
+	case "", StateCompressionNone, StateCompressionGzip, StateCompressionZstd:
+		return nil
+	default:
+		return fmt.Errorf("illegal compression: '%s'", string(this))
+	}
+}
+
+func (this StateCompression) extension() string {
+	switch this {
+	case StateCompressionGzip:
+		return ".gz"
+	case StateCompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+func stateCompressionOfExtension(ext string) StateCompression {
+	switch ext {
+	case ".gz":
+		return StateCompressionGzip
+	case ".zst":
+		return StateCompressionZstd
+	default:
+		return StateCompressionNone
+	}
+}
+
+func (this StateCompression) compress(in []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch this {
+	case StateCompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case StateCompressionZstd:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		w = zw
+	default:
+		return in, nil
+	}
+	if _, err := w.Write(in); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (this StateCompression) decompress(in []byte) ([]byte, error) {
+	switch this {
+	case StateCompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(in))
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = r.Close()
+		}()
+		return io.ReadAll(r)
+	case StateCompressionZstd:
+		r, err := zstd.NewReader(bytes.NewReader(in))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	default:
+		return in, nil
+	}
+}
+
+var statePartAttachmentFileRegex = regexp.MustCompile(`^terraform-state-(\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}\.\d{6})\.part-\d{4}$`)
+
+// stateManifest describes a revision which was split into several chunks.
+// The manifest is always written after all of its parts; so a revision is
+// only visible if it is complete.
+type stateManifest struct {
+	Compression StateCompression `json:"compression"`
+	Size        int              `json:"size"`
+	Parts       []string         `json:"parts"`
+}
+
+func (this *Store) writeStateAttachments(b *bitwarden.Bitwarden, item *bitwarden.Item, at time.Time, encoded []byte) error {
+	sc := this.GetConfig().GetState()
+	compression := sc.GetCompression()
+	data, err := compression.compress(encoded)
+	if err != nil {
+		return fmt.Errorf("cannot compress state for item %v (%v): %w", item.Name, item.Id, err)
+	}
+
+	base := "terraform-state-" + at.UTC().Format(storeAttachmentFileTimePattern)
+	digest := digestOf(encoded)
+	chunkSize := int(sc.GetChunkSize())
+	if chunkSize <= 0 || len(data) <= chunkSize {
+		return this.createAttachment(b, item, base+digest.fileNameSuffix()+".json"+compression.extension(), data)
+	}
+
+	manifest := stateManifest{
+		Compression: compression,
+		Size:        len(data),
+	}
+	for i := 0; i*chunkSize < len(data); i++ {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		fn := fmt.Sprintf("%s.part-%04d", base, i)
+		if err := this.createAttachment(b, item, fn, data[i*chunkSize:end]); err != nil {
+			this.deleteIncompleteParts(b, item, manifest.Parts)
+			return err
+		}
+		manifest.Parts = append(manifest.Parts, fn)
+	}
+
+	mb, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("cannot encode state manifest for item %v (%v): %w", item.Name, item.Id, err)
+	}
+	if err := this.createAttachment(b, item, base+digest.fileNameSuffix()+".manifest.json", mb); err != nil {
+		this.deleteIncompleteParts(b, item, manifest.Parts)
+		return err
+	}
+	return nil
+}
+
+// deleteIncompleteParts removes the already uploaded parts of a state which
+// could not be written completely. Parts which cannot be removed now will be
+// removed on next deletion of the state.
+func (this *Store) deleteIncompleteParts(b *bitwarden.Bitwarden, item *bitwarden.Item, parts []string) {
+	for _, part := range parts {
+		ref, ok := this.attachmentReferenceByFileName(item, part)
+		if !ok {
+			continue
+		}
+		if err := this.deleteAttachment(b, item, ref); err != nil {
+			log.WithError(err).
+				With("itemName", item.Name).
+				With("itemId", item.Id).
+				With("part", part).
+				Warn("Cannot remove part of incompletely written state; it will be removed on next deletion of the state.")
+		}
+	}
+}
+
+func (this *Store) readStateAttachments(b *bitwarden.Bitwarden, item *bitwarden.Item, aref *timedAttachmentReference) ([]byte, error) {
+	content, err := b.GetAttachmentContent(*item, aref.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	compression := aref.compression
+	if aref.chunked {
+		var manifest stateManifest
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return nil, fmt.Errorf("%w: cannot decode state manifest %s of item %v (%v): %v", ErrStateCorrupt, aref.FileName, item.Name, item.Id, err)
+		}
+		content = make([]byte, 0, manifest.Size)
+		for _, part := range manifest.Parts {
+			pref, ok := this.attachmentReferenceByFileName(item, part)
+			if !ok {
+				return nil, fmt.Errorf("%w: state manifest %s of item %v (%v) references missing part %s", ErrStateCorrupt, aref.FileName, item.Name, item.Id, part)
+			}
+			pc, err := b.GetAttachmentContent(*item, pref.Id)
+			if err != nil {
+				return nil, err
+			}
+			content = append(content, pc...)
+		}
+		if len(content) != manifest.Size {
+			return nil, fmt.Errorf("%w: state manifest %s of item %v (%v) expects %d bytes but parts contain %d bytes", ErrStateCorrupt, aref.FileName, item.Name, item.Id, manifest.Size, len(content))
+		}
+		compression = manifest.Compression
+	}
+
+	result, err := compression.decompress(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot decompress state of attachment %s of item %v (%v): %v", ErrStateCorrupt, aref.FileName, item.Name, item.Id, err)
+	}
+	return result, nil
+}
+
+// deleteStateAttachments deletes the attachment of the given revision
+// including all of its parts (if chunked) and its metadata.
+func (this *Store) deleteStateAttachments(b *bitwarden.Bitwarden, item *bitwarden.Item, aref *timedAttachmentReference) error {
+	if aref.chunked {
+		for _, ref := range this.partAttachmentReferencesOf(item, aref.time) {
+			if err := this.deleteAttachment(b, item, ref); err != nil {
+				return err
+			}
+		}
+	}
+	for _, ref := range this.metadataAttachmentReferencesOf(item, aref.time) {
+		if err := this.deleteAttachment(b, item, ref); err != nil {
+			return err
+		}
+	}
+	return this.deleteAttachment(b, item, *aref.ItemAttachmentReference)
+}
+
+func (this *Store) attachmentReferenceByFileName(item *bitwarden.Item, fn string) (bitwarden.ItemAttachmentReference, bool) {
+	for _, ref := range item.AttachmentReferences {
+		if candidate, ok := this.fileNameOf(ref); ok && candidate == fn {
+			return ref, true
+		}
+	}
+	return bitwarden.ItemAttachmentReference{}, false
+}
+
+// partAttachmentReferencesOf returns all parts of the revision at the given
+// time. If the time is zero all parts of all revisions are returned.
+func (this *Store) partAttachmentReferencesOf(item *bitwarden.Item, at time.Time) (result bitwarden.ItemAttachmentReferences) {
+	for _, ref := range item.AttachmentReferences {
+		fn, ok := this.fileNameOf(ref)
+		if !ok {
+			continue
+		}
+		m := statePartAttachmentFileRegex.FindStringSubmatch(fn)
+		if m == nil {
+			continue
+		}
+		if at.IsZero() || m[1] == at.Format(storeAttachmentFileTimePattern) {
+			result = append(result, ref)
+		}
+	}
+	return
+}
@@ -0,0 +1,125 @@
+package backend
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStore_PutState_attachmentRoundTrip(t *testing.T) {
+	chunkSize := int64(256)
+	cases := []struct {
+		name        string
+		compression StateCompression
+		chunkSize   *int64
+		extension   string
+	}{
+		{"plain", "", nil, ".json"},
+		{"none", StateCompressionNone, nil, ".json"},
+		{"gzip", StateCompressionGzip, nil, ".json.gz"},
+		{"zstd", StateCompressionZstd, nil, ".json.zst"},
+		{"chunked", StateCompressionNone, &chunkSize, ".manifest.json"},
+		{"chunked gzip", StateCompressionGzip, &chunkSize, ".manifest.json"},
+		{"chunked zstd", StateCompressionZstd, &chunkSize, ".manifest.json"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newFakeVaultClients(t, ConfigState{Compression: c.compression, ChunkSize: c.chunkSize}, 1)[0]
+			sb, _ := s.Bitwarden()
+
+			var written []map[string]interface{}
+			for serial := 1; serial <= 3; serial++ {
+				state := notesTestState(t, serial)
+				if err := s.PutState(concurrencyTestRef, state, map[string]interface{}{"serial": serial}, false); err != nil {
+					t.Fatal(err)
+				}
+				written = append(written, state)
+			}
+
+			actual, _, err := s.GetState(concurrencyTestRef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Compare the JSON representation, like it was read by Terraform.
+			if expected := normalizedTestState(t, written[2]); !reflect.DeepEqual(actual, expected) {
+				t.Errorf("expected latest written state but got serial %v", actual["serial"])
+			}
+
+			item, err := s.getItem(sb, concurrencyTestRef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			revs, err := s.stateRevisionsOf(item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The default retention policy keeps 2 revisions.
+			if len(revs) != 2 {
+				t.Fatalf("expected 2 revisions but got %d", len(revs))
+			}
+			for i, rev := range revs {
+				if !strings.HasSuffix(rev.attachment.FileName, c.extension) {
+					t.Errorf("expected attachment %s to end with %s", rev.attachment.FileName, c.extension)
+				}
+				if rev.attachment.chunked != (c.chunkSize != nil) {
+					t.Errorf("expected attachment %s to be chunked=%v", rev.attachment.FileName, c.chunkSize != nil)
+				}
+				state, err := s.readStateRevision(sb, item, rev)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if expected := normalizedTestState(t, written[2-i]); !reflect.DeepEqual(state, expected) {
+					t.Errorf("expected state of serial %v in revision %s but got serial %v", expected["serial"], rev.revision(), state["serial"])
+				}
+				metadata, err := s.readStateMetadata(sb, item, rev)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if metadata["serial"] != float64(3-i) {
+					t.Errorf("expected metadata of serial %d in revision %s but got %v", 3-i, rev.revision(), metadata)
+				}
+			}
+
+			// Parts and metadata of the expired revision have to be removed
+			// together with it.
+			parts := s.partAttachmentReferencesOf(item, revs[0].time)
+			if c.chunkSize == nil && len(parts) != 0 {
+				t.Errorf("expected no parts but got %v", parts)
+			}
+			if c.chunkSize != nil && len(parts) < 2 {
+				t.Errorf("expected several parts but got %v", parts)
+			}
+			expected := 2 * (1 + 1 + len(parts))
+			if len(item.AttachmentReferences) != expected {
+				t.Errorf("expected %d attachments but got %d: %v", expected, len(item.AttachmentReferences), item.AttachmentReferences)
+			}
+		})
+	}
+}
+
+func normalizedTestState(t *testing.T, state map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for k, v := range state {
+		if i, ok := v.(int); ok {
+			result[k] = float64(i)
+		} else {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func TestConfigState_Validate_chunkSize(t *testing.T) {
+	for _, v := range []int64{0, -1} {
+		if err := (ConfigState{ChunkSize: &v}).Validate(); err == nil {
+			t.Errorf("expected chunk_size %d to be invalid", v)
+		}
+	}
+	v := int64(1)
+	if err := (ConfigState{ChunkSize: &v}).Validate(); err != nil {
+		t.Errorf("expected chunk_size 1 to be valid but got %v", err)
+	}
+	if actual := (ConfigState{}).GetChunkSize(); actual != 0 {
+		t.Errorf("expected states not to be chunked by default but got chunk_size %d", actual)
+	}
+}
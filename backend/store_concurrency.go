@@ -0,0 +1,235 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/echocat/slf4g"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"math/rand/v2"
+	"time"
+)
+
+var (
+	// ErrConcurrentModification is returned if an item was modified by
+	// someone else while it was processed.
+	ErrConcurrentModification = errors.New("concurrent modification")
+
+	// ErrLockConflict is returned if a lock was acquired by someone else at
+	// the same time.
+	ErrLockConflict = errors.New("lock conflict")
+)
+
+const (
+	concurrentModificationAttempts = 3
+	concurrentModificationBackoff  = 500 * time.Millisecond
+)
+
+// retryOnConcurrentModification executes the given action again if it
+// failed because of ErrConcurrentModification. The backoff contains a random
+// part; so competing writers do not retry in lockstep. After the last attempt
+// the error is returned as is.
+func (this *Store) retryOnConcurrentModification(plainRef string, action func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := action()
+		if errors.Is(err, bitwarden.ErrItemOutOfDate) {
+			err = fmt.Errorf("%w: %v", ErrConcurrentModification, err)
+		}
+		if !errors.Is(err, ErrConcurrentModification) || attempt >= concurrentModificationAttempts {
+			return err
+		}
+		log.WithError(err).
+			With("ref", plainRef).
+			With("attempt", attempt).
+			Info("Item was modified concurrently; retrying.")
+		time.Sleep(time.Duration(attempt)*concurrentModificationBackoff + rand.N(concurrentModificationBackoff))
+	}
+}
+
+// verifyRevisionOf compares the revision date of the given item with the one
+// currently stored in Bitwarden and returns ErrConcurrentModification if
+// someone else modified the item since it was read.
+//
+// Bitwarden has no conditional writes for attachments; so this is checked
+// before each of them. Edits of the notes do not need this, because Bitwarden
+// itself rejects them if the item was modified since the last sync (see
+// bitwarden.ErrItemOutOfDate) and the sync done here is only accepted if the
+// item was not modified.
+func (this *Store) verifyRevisionOf(b *bitwarden.Bitwarden, item *bitwarden.Item) error {
+	current, err := this.reloadItem(b, item)
+	if err != nil {
+		return err
+	}
+	if !sameRevisionDate(item, current) {
+		return fmt.Errorf("%w: item %v (%v) was modified since it was read (revision %v, now %v)", ErrConcurrentModification, item.Name, item.Id, revisionDateOf(item), revisionDateOf(current))
+	}
+	return nil
+}
+
+func (this *Store) reloadItem(b *bitwarden.Bitwarden, item *bitwarden.Item) (*bitwarden.Item, error) {
+	if err := b.Sync(); err != nil {
+		return nil, err
+	}
+	return b.GetItem(item.Id, nil)
+}
+
+func sameRevisionDate(a, b *bitwarden.Item) bool {
+	if a.RevisionDate == nil || b.RevisionDate == nil {
+		return a.RevisionDate == nil && b.RevisionDate == nil
+	}
+	return a.RevisionDate.Equal(*b.RevisionDate)
+}
+
+func revisionDateOf(item *bitwarden.Item) string {
+	if item.RevisionDate == nil {
+		return "<none>"
+	}
+	return item.RevisionDate.Format(time.RFC3339Nano)
+}
+
+// createAttachment adds the attachment (with the given name inside of the
+// scope of this store) to the item and updates the item to
+// the one returned by Bitwarden. Before the write the revision of the item is
+// verified (see verifyRevisionOf). Because someone else could still write
+// in between, the returned item is compared with the one the write was
+// based on, too. If anything else than the new attachment differs, the own
+// attachment is removed again and ErrConcurrentModification is returned.
+func (this *Store) createAttachment(b *bitwarden.Bitwarden, item *bitwarden.Item, name string, data []byte) error {
+	name = this.prefixed(name)
+	if err := this.verifyRevisionOf(b, item); err != nil {
+		return err
+	}
+	updated, err := b.CreateAttachment(*item, name, data)
+	if err != nil {
+		return err
+	}
+
+	var added bitwarden.ItemAttachmentReferences
+	for _, candidate := range updated.AttachmentReferences {
+		if _, ok := attachmentReferenceById(item, candidate.Id); !ok {
+			added = append(added, candidate)
+		}
+	}
+	if len(added) == 1 && len(updated.AttachmentReferences) == len(item.AttachmentReferences)+1 && updated.Notes == item.Notes {
+		*item = *updated
+		return nil
+	}
+
+	if err := this.deleteOwnAttachment(b, updated, added, name, data); err != nil {
+		log.WithError(err).
+			With("itemName", item.Name).
+			With("itemId", item.Id).
+			With("attachmentName", name).
+			Warn("Cannot remove attachment again after a concurrent modification was detected.")
+	}
+	return fmt.Errorf("%w: item %v (%v) was modified while attachment %s was written", ErrConcurrentModification, item.Name, item.Id, name)
+}
+
+// deleteOwnAttachment deletes the attachment with the given name and content
+// from the candidates. Only if there is more than one candidate with this
+// name their contents are compared.
+func (this *Store) deleteOwnAttachment(b *bitwarden.Bitwarden, item *bitwarden.Item, candidates bitwarden.ItemAttachmentReferences, name string, data []byte) error {
+	var named bitwarden.ItemAttachmentReferences
+	for _, candidate := range candidates {
+		if candidate.FileName == name {
+			named = append(named, candidate)
+		}
+	}
+	for _, candidate := range named {
+		if len(named) > 1 {
+			content, err := b.GetAttachmentContent(*item, candidate.Id)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(content, data) {
+				continue
+			}
+		}
+		return b.DeleteAttachment(*item, candidate)
+	}
+	return nil
+}
+
+// deleteAttachment deletes the attachment if the item was not modified since
+// it was read (see verifyRevisionOf) and removes it from the item. Bitwarden
+// does not return the item after the deletion; so it is reloaded afterwards to
+// know its new revision. If the reloaded item contains other attachments than
+// expected, someone else modified it in between and ErrConcurrentModification
+// is returned.
+func (this *Store) deleteAttachment(b *bitwarden.Bitwarden, item *bitwarden.Item, ref bitwarden.ItemAttachmentReference) error {
+	if err := this.verifyRevisionOf(b, item); err != nil {
+		return err
+	}
+	if err := b.DeleteAttachment(*item, ref); err != nil {
+		return err
+	}
+	var remaining bitwarden.ItemAttachmentReferences
+	for _, candidate := range item.AttachmentReferences {
+		if candidate.Id != ref.Id {
+			remaining = append(remaining, candidate)
+		}
+	}
+
+	current, err := this.reloadItem(b, item)
+	if err != nil {
+		return err
+	}
+	if !sameAttachmentIds(remaining, current.AttachmentReferences) || current.Notes != item.Notes {
+		return fmt.Errorf("%w: item %v (%v) was modified while attachment %s was deleted", ErrConcurrentModification, item.Name, item.Id, ref.FileName)
+	}
+	*item = *current
+	return nil
+}
+
+func sameAttachmentIds(a, b bitwarden.ItemAttachmentReferences) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ids := make(map[string]bool, len(a))
+	for _, candidate := range a {
+		ids[candidate.Id] = true
+	}
+	for _, candidate := range b {
+		if !ids[candidate.Id] {
+			return false
+		}
+	}
+	return true
+}
+
+func attachmentReferenceById(item *bitwarden.Item, id string) (bitwarden.ItemAttachmentReference, bool) {
+	for _, candidate := range item.AttachmentReferences {
+		if candidate.Id == id {
+			return candidate, true
+		}
+	}
+	return bitwarden.ItemAttachmentReference{}, false
+}
+
+type lockAttachment struct {
+	lock storedLock
+	ref  bitwarden.ItemAttachmentReference
+}
+
+// lockAttachmentsOf returns all locks stored as attachments in the order they
+// are listed by Bitwarden. If more than one exists (because a concurrent write
+// could not be removed again) the first one is the valid one.
+func (this *Store) lockAttachmentsOf(b *bitwarden.Bitwarden, item *bitwarden.Item) ([]lockAttachment, error) {
+	var result []lockAttachment
+	for _, aref := range item.AttachmentReferences {
+		if fn, ok := this.fileNameOf(aref); !ok || fn != lockAttachmentFileName {
+			continue
+		}
+		attachment, err := b.GetAttachmentContent(*item, aref.Id)
+		if err != nil {
+			return nil, err
+		}
+		var buf storedLock
+		if err := json.Unmarshal(attachment, &buf); err != nil {
+			return nil, fmt.Errorf("cannot decode lock of attachment %s of item %v (%v)", aref.FileName, item.Name, item.Id)
+		}
+		result = append(result, lockAttachment{buf, aref})
+	}
+	return result, nil
+}
@@ -0,0 +1,181 @@
+package backend
+
+import (
+	"errors"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"sync"
+	"testing"
+)
+
+const concurrencyTestRef = "name:terraform-state"
+
+func concurrencyTestState(serial int, client int) map[string]interface{} {
+	return map[string]interface{}{
+		"lineage": "2c1d8e5a-0000-0000-0000-000000000000",
+		"serial":  float64(serial),
+		"client":  client,
+	}
+}
+
+func TestStore_createAttachment_detectsConcurrentModification(t *testing.T) {
+	clients := newFakeVaultClients(t, ConfigState{}, 2)
+	a, b := clients[0], clients[1]
+	if err := a.PutState(concurrencyTestRef, concurrencyTestState(1, 0), nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	ab, _ := a.Bitwarden()
+	item, err := a.getItem(ab, concurrencyTestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// b writes after a has read the item, but before a writes.
+	if err := b.PutState(concurrencyTestRef, concurrencyTestState(2, 1), nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.createAttachment(ab, item, "foo.json", []byte(`{}`))
+	if !errors.Is(err, ErrConcurrentModification) {
+		t.Fatalf("expected concurrent modification but got %v", err)
+	}
+
+	item, err = a.getItem(ab, concurrencyTestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.attachmentReferenceByFileName(item, "foo.json"); ok {
+		t.Errorf("attachment of the rejected write still exists: %+v", item.AttachmentReferences)
+	}
+}
+
+func TestStore_deleteAttachment_detectsConcurrentModification(t *testing.T) {
+	clients := newFakeVaultClients(t, ConfigState{}, 2)
+	a, b := clients[0], clients[1]
+	if err := a.PutState(concurrencyTestRef, concurrencyTestState(1, 0), nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	ab, _ := a.Bitwarden()
+	item, err := a.getItem(ab, concurrencyTestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revs, err := a.stateRevisionsOf(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// b only changes the revision of the item; the attachment to delete is
+	// untouched.
+	bb, _ := b.Bitwarden()
+	bItem, err := b.getItem(bb, concurrencyTestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bb.EditItem(*bItem, map[string]interface{}{"name": bItem.Name}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.deleteAttachment(ab, item, *revs[0].attachment.ItemAttachmentReference)
+	if !errors.Is(err, ErrConcurrentModification) {
+		t.Fatalf("expected concurrent modification but got %v", err)
+	}
+
+	item, err = a.getItem(ab, concurrencyTestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := attachmentReferenceById(item, revs[0].attachment.Id); !ok {
+		t.Errorf("attachment was deleted although the item was modified: %+v", item.AttachmentReferences)
+	}
+
+	// Based on the current revision the deletion succeeds and the item
+	// reflects the new revision for further writes.
+	if err := a.deleteAttachment(ab, item, *revs[0].attachment.ItemAttachmentReference); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.verifyRevisionOf(ab, item); err != nil {
+		t.Errorf("expected item to be up to date after own deletion but got %v", err)
+	}
+}
+
+func TestStore_writeNotesDocument_detectsConcurrentModification(t *testing.T) {
+	clients := newFakeVaultClients(t, ConfigState{Storage: StateStorageNotes}, 2)
+	a, b := clients[0], clients[1]
+	if err := a.PutState(concurrencyTestRef, concurrencyTestState(1, 0), nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	ab, _ := a.Bitwarden()
+	item, err := a.getItem(ab, concurrencyTestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.PutState(concurrencyTestRef, concurrencyTestState(2, 1), nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.writeNotesDocument(ab, item, notesDocument{}); !errors.Is(err, bitwarden.ErrItemOutOfDate) {
+		t.Fatalf("expected out of date but got %v", err)
+	}
+}
+
+func TestStore_PutState_concurrentClients(t *testing.T) {
+	clients := newFakeVaultClients(t, ConfigState{MaxRevisions: 100}, 4)
+	// The item has to exist already; otherwise every client would create it.
+	if err := clients[0].PutState(concurrencyTestRef, concurrencyTestState(1, -1), nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make([]error, len(clients))
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, client *Store) {
+			defer wg.Done()
+			errs[i] = client.PutState(concurrencyTestRef, concurrencyTestState(1, i), nil, false)
+		}(i, client)
+	}
+	wg.Wait()
+
+	expected := map[float64]bool{-1: true}
+	for i, err := range errs {
+		if err == nil {
+			expected[float64(i)] = true
+		} else if !errors.Is(err, ErrConcurrentModification) {
+			t.Errorf("client %d failed unexpectedly: %v", i, err)
+		}
+	}
+
+	s := clients[0]
+	sb, _ := s.Bitwarden()
+	item, err := s.getItem(sb, concurrencyTestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revs, err := s.stateRevisionsOf(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := map[float64]bool{}
+	for _, rev := range revs {
+		state, err := s.readStateRevision(sb, item, rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual[state["client"].(float64)] = true
+	}
+
+	// Every successful write has to be stored exactly once and every
+	// rejected one has to be removed again.
+	if len(revs) != len(expected) || len(actual) != len(expected) {
+		t.Errorf("expected revisions of clients %v but got %v (%d revisions)", expected, actual, len(revs))
+	}
+	for client := range expected {
+		if !actual[client] {
+			t.Errorf("expected revision of client %v but got %v", client, actual)
+		}
+	}
+}
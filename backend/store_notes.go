@@ -0,0 +1,229 @@
+package backend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const notesDocumentPrefix = "terraform-backend-bitwarden:v1:"
+
+// ErrForeignNotes is returned if the notes of an item should be used as state
+// storage but already contain content which was not written by the backend.
+var ErrForeignNotes = errors.New("notes already contain foreign content")
+
+// notesMaxLength is the maximum length of the encoded notes document. Bitwarden
+// limits the encrypted notes to 10.000 characters; encryption and its encoding
+// adds roughly one third plus some constant overhead.
+const notesMaxLength = 7000
+
+type notesDocument struct {
+	Revisions notesRevisions `json:"revisions,omitempty"`
+	Lock      *storedLock    `json:"lock,omitempty"`
+}
+
+type notesRevision struct {
+	Time   time.Time       `json:"time"`
+	State  json.RawMessage `json:"state"`
+	Sha256 string          `json:"sha256,omitempty"`
+	Size   int64           `json:"size,omitempty"`
+
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+func (this notesRevision) revision() string {
+	return this.Time.Format(storeAttachmentFileTimePattern)
+}
+
+type notesRevisions []notesRevision
+
+func (a notesRevisions) Less(i, j int) bool {
+	return a[i].Time.After(a[j].Time)
+}
+
+func (a notesRevisions) Len() int      { return len(a) }
+func (a notesRevisions) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+
+func (this notesRevisions) without(revs stateRevisions) (result notesRevisions) {
+	for _, candidate := range this {
+		found := false
+		for _, rev := range revs {
+			if rev.notes != nil && rev.time.Equal(candidate.Time) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, candidate)
+		}
+	}
+	return
+}
+
+func isNotesDocument(notes string) bool {
+	return strings.HasPrefix(notes, notesDocumentPrefix)
+}
+
+// hasNotesDocument returns true if the notes of the item contain states or a
+// lock. The notes always belong to the workspace which uses the item without
+// an attachment prefix.
+func (this *Store) hasNotesDocument(item *bitwarden.Item) bool {
+	return this.attachmentPrefix == "" && isNotesDocument(item.Notes)
+}
+
+func (this *Store) readNotesDocument(item *bitwarden.Item) (*notesDocument, error) {
+	if item.Notes == "" {
+		return &notesDocument{}, nil
+	}
+	if !isNotesDocument(item.Notes) {
+		return nil, fmt.Errorf("%w: notes of item %v (%v) cannot be used as state storage", ErrForeignNotes, item.Name, item.Id)
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(item.Notes, notesDocumentPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode notes of item %v (%v): %w", item.Name, item.Id, err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode notes of item %v (%v): %w", item.Name, item.Id, err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode notes of item %v (%v): %w", item.Name, item.Id, err)
+	}
+
+	var result notesDocument
+	if err := json.Unmarshal(plain, &result); err != nil {
+		return nil, fmt.Errorf("cannot decode notes of item %v (%v): %w", item.Name, item.Id, err)
+	}
+	sort.Sort(result.Revisions)
+	return &result, nil
+}
+
+func (this *Store) encodeNotesDocument(doc notesDocument) (string, error) {
+	plain, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(plain); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return notesDocumentPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// writeNotesDocument stores the given document in the notes of the item. It
+// returns false if the document is too large to be stored in notes.
+func (this *Store) writeNotesDocument(b *bitwarden.Bitwarden, item *bitwarden.Item, doc notesDocument) (bool, error) {
+	var notes string
+	if len(doc.Revisions) > 0 || doc.Lock != nil {
+		encoded, err := this.encodeNotesDocument(doc)
+		if err != nil {
+			return false, fmt.Errorf("cannot encode notes of item %v (%v): %w", item.Name, item.Id, err)
+		}
+		if len(encoded) > notesMaxLength {
+			return false, nil
+		}
+		notes = encoded
+	}
+
+	updated, err := b.EditItem(*item, map[string]interface{}{"notes": notes})
+	if err != nil {
+		return false, err
+	}
+	*item = *updated
+	return true, nil
+}
+
+// putStateIntoNotes adds a new revision to the notes and drops all of the
+// given expired revisions which are stored in the notes. Revisions which are
+// kept by the retention policy are never dropped to make room; so it returns
+// false if the new revision does not fit next to them.
+func (this *Store) putStateIntoNotes(b *bitwarden.Bitwarden, item *bitwarden.Item, encoded []byte, metadata map[string]interface{}, at time.Time, expired stateRevisions) (bool, error) {
+	doc, err := this.readNotesDocument(item)
+	if err != nil {
+		return false, err
+	}
+
+	digest := digestOf(encoded)
+	doc.Revisions = append(notesRevisions{{
+		Time:   at,
+		State:  encoded,
+		Sha256: digest.Sha256,
+		Size:   digest.Size,
+
+		Metadata: metadata,
+	}}, doc.Revisions.without(expired)...)
+
+	return this.writeNotesDocument(b, item, *doc)
+}
+
+// deleteRevisionsFromNotes removes all of the given revisions which are stored
+// in the notes. The notes are only touched if there is something to remove.
+func (this *Store) deleteRevisionsFromNotes(b *bitwarden.Bitwarden, item *bitwarden.Item, revs stateRevisions) error {
+	if !this.hasNotesDocument(item) {
+		return nil
+	}
+	doc, err := this.readNotesDocument(item)
+	if err != nil {
+		return err
+	}
+	remaining := doc.Revisions.without(revs)
+	if len(remaining) == len(doc.Revisions) {
+		return nil
+	}
+	doc.Revisions = remaining
+	_, err = this.writeNotesDocument(b, item, *doc)
+	return err
+}
+
+func (this *Store) deleteStatesFromNotes(b *bitwarden.Bitwarden, item *bitwarden.Item) error {
+	if !this.hasNotesDocument(item) {
+		return nil
+	}
+	doc, err := this.readNotesDocument(item)
+	if err != nil {
+		return err
+	}
+	if len(doc.Revisions) == 0 {
+		return nil
+	}
+	doc.Revisions = nil
+	_, err = this.writeNotesDocument(b, item, *doc)
+	return err
+}
+
+func (this *Store) getLockFromNotes(item *bitwarden.Item) (*storedLock, error) {
+	if !this.hasNotesDocument(item) {
+		return nil, nil
+	}
+	doc, err := this.readNotesDocument(item)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Lock, nil
+}
+
+// putLockIntoNotes stores the given lock (or removes it if nil) in the notes.
+// Stored revisions are never dropped for a lock; so it returns false if the
+// lock does not fit into the notes anymore.
+func (this *Store) putLockIntoNotes(b *bitwarden.Bitwarden, item *bitwarden.Item, lock *storedLock) (bool, error) {
+	doc, err := this.readNotesDocument(item)
+	if err != nil {
+		return false, err
+	}
+	doc.Lock = lock
+	return this.writeNotesDocument(b, item, *doc)
+}
@@ -0,0 +1,126 @@
+package backend
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/bhoriuchi/terraform-backend-http/go/types"
+	"testing"
+)
+
+// notesTestState returns a state which cannot be compressed; so only two of
+// them fit into the notes.
+func notesTestState(t *testing.T, serial int) map[string]interface{} {
+	buf := make([]byte, 2100)
+	if _, err := rand.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	result := concurrencyTestState(serial, serial)
+	result["data"] = base64.StdEncoding.EncodeToString(buf)
+	return result
+}
+
+func TestStore_PutState_notesKeepRetainedRevisions(t *testing.T) {
+	s := newFakeVaultClients(t, ConfigState{Storage: StateStorageNotes, MaxRevisions: 3}, 1)[0]
+	sb, _ := s.Bitwarden()
+
+	revisionsOf := func() stateRevisions {
+		item, err := s.getItem(sb, concurrencyTestRef)
+		if err != nil {
+			t.Fatal(err)
+		}
+		revs, err := s.stateRevisionsOf(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return revs
+	}
+	clientsOf := func(revs stateRevisions) (result []float64, storages []StateStorage) {
+		item, err := s.getItem(sb, concurrencyTestRef)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rev := range revs {
+			state, err := s.readStateRevision(sb, item, rev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, state["client"].(float64))
+			storages = append(storages, rev.storage())
+		}
+		return
+	}
+
+	for serial := 1; serial <= 3; serial++ {
+		if err := s.PutState(concurrencyTestRef, notesTestState(t, serial), nil, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The third revision does not fit into the notes anymore; but none of the
+	// first two can be dropped, because the retention policy keeps them.
+	clients, storages := clientsOf(revisionsOf())
+	if len(clients) != 3 || clients[0] != 3 || clients[1] != 2 || clients[2] != 1 {
+		t.Fatalf("expected revisions of clients [3 2 1] but got %v", clients)
+	}
+	if storages[0] != StateStorageAttachment || storages[1] != StateStorageNotes || storages[2] != StateStorageNotes {
+		t.Errorf("expected the newest revision in attachments and the others in notes but got %v", storages)
+	}
+
+	// Now the first revision expires and makes room in the notes again.
+	if err := s.PutState(concurrencyTestRef, notesTestState(t, 4), nil, false); err != nil {
+		t.Fatal(err)
+	}
+	clients, storages = clientsOf(revisionsOf())
+	if len(clients) != 3 || clients[0] != 4 || clients[1] != 3 || clients[2] != 2 {
+		t.Fatalf("expected revisions of clients [4 3 2] but got %v", clients)
+	}
+	if storages[0] != StateStorageNotes {
+		t.Errorf("expected the newest revision in notes but got %v", storages)
+	}
+}
+
+func TestStore_PutState_notesWithForeignContent(t *testing.T) {
+	s := newFakeVaultClients(t, ConfigState{Storage: StateStorageNotes}, 1)[0]
+	sb, _ := s.Bitwarden()
+
+	item, err := s.createItem(sb, concurrencyTestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const foreign = "Some notes of a human."
+	if _, err := sb.EditItem(*item, map[string]interface{}{"notes": foreign}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.PutState(concurrencyTestRef, concurrencyTestState(1, 0), nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutLock(concurrencyTestRef, types.Lock{ID: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if state, _, err := s.GetState(concurrencyTestRef); err != nil {
+		t.Fatal(err)
+	} else if state["client"] != float64(0) {
+		t.Errorf("expected written state but got %v", state)
+	}
+	if lock, err := s.GetLock(concurrencyTestRef); err != nil {
+		t.Fatal(err)
+	} else if lock.ID != "foo" {
+		t.Errorf("expected written lock but got %v", lock)
+	}
+
+	item, err = s.getItem(sb, concurrencyTestRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Notes != foreign {
+		t.Errorf("expected notes to be untouched but got %q", item.Notes)
+	}
+	revs, err := s.stateRevisionsOf(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 1 || revs[0].storage() != StateStorageAttachment {
+		t.Errorf("expected one revision in attachments but got %v", revs)
+	}
+}
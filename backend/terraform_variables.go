@@ -0,0 +1,237 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/echocat/slf4g"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// TerraformVariablesMode defines how resolved variables are handed over to
+// Terraform.
+type TerraformVariablesMode string
+
+const (
+	// TerraformVariablesModeEnvironment exports every variable as TF_VAR_*.
+	TerraformVariablesModeEnvironment = TerraformVariablesMode("environment")
+	// TerraformVariablesModeAutoTfvars writes all variables into a temporary
+	// *.auto.tfvars.json file inside the working directory of Terraform which
+	// is loaded by Terraform automatically.
+	TerraformVariablesModeAutoTfvars = TerraformVariablesMode("auto_tfvars")
+	// TerraformVariablesModeVarFile writes all variables into a temporary
+	// file which is passed as -var-file to the commands supporting it.
+	TerraformVariablesModeVarFile = TerraformVariablesMode("var_file")
+)
+
+// autoTfvarsFilePattern is the pattern of the files written for
+// TerraformVariablesModeAutoTfvars. It should be part of .gitignore.
+const autoTfvarsFilePattern = "bitwarden-*.auto.tfvars.json"
+
+// varFileCommands are all commands of Terraform which accept -var-file.
+var varFileCommands = map[string]struct{}{
+	"apply":   {},
+	"console": {},
+	"destroy": {},
+	"import":  {},
+	"plan":    {},
+	"refresh": {},
+}
+
+func (this TerraformVariablesMode) Validate() error {
+	switch this {
+	case "", TerraformVariablesModeEnvironment, TerraformVariablesModeAutoTfvars, TerraformVariablesModeVarFile:
+		return nil
+	default:
+		return fmt.Errorf("illegal variables mode: '%s'", string(this))
+	}
+}
+
+func (this *TerraformVariablesMode) Set(plain string) error {
+	buf := TerraformVariablesMode(plain)
+	if err := buf.Validate(); err != nil {
+		return err
+	}
+	*this = buf
+	return nil
+}
+
+func (this TerraformVariablesMode) String() string {
+	return string(this)
+}
+
+// provideTerraformVariables resolves all variables and either adds them to
+// the given environment or writes them into a temporary file (see
+// TerraformVariablesMode). The file is removed on Close.
+func (this *Backend) provideTerraformVariables(b *bitwarden.Bitwarden, env map[string]string) error {
+	vars, err := this.config.Variables.Resolve(b)
+	if err != nil {
+		return err
+	}
+	// This is already passed as TF_ENCRYPTION.
+	delete(vars, this.config.GetTerraform().EncryptionVariable)
+	if len(vars) == 0 {
+		return nil
+	}
+
+	mode := this.config.GetTerraform().GetVariablesMode()
+	if mode == TerraformVariablesModeVarFile && !this.terraformCommandAcceptsVarFile() {
+		// Otherwise commands without -var-file would get no variables at all.
+		log.With("args", this.TerraformArgs).
+			Debug("Command does not accept -var-file; variables are passed as environment variables.")
+		mode = TerraformVariablesModeEnvironment
+	}
+
+	switch mode {
+	case TerraformVariablesModeAutoTfvars:
+		if err := this.writeVariablesFile(this.terraformWorkingDirectory(), autoTfvarsFilePattern, vars); err != nil {
+			return err
+		}
+		warnIfNotIgnoredByGit(this.variablesFile)
+		return nil
+	case TerraformVariablesModeVarFile:
+		// Only the current user can access this directory; so nobody else
+		// can even see that the file exists.
+		dir, err := os.MkdirTemp("", "terraform-bitwarden-*")
+		if err != nil {
+			return fmt.Errorf("cannot create directory for variables file: %w", err)
+		}
+		this.variablesDir = dir
+		return this.writeVariablesFile(dir, "variables-*.tfvars.json", vars)
+	default:
+		for k, v := range vars {
+			ev, err := encodeEnvironmentValue(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+			env[terraformVariableEnvPrefix+k] = ev
+		}
+		return nil
+	}
+}
+
+func (this *Backend) writeVariablesFile(dir, pattern string, vars map[string]interface{}) (rErr error) {
+	encoded, err := json.MarshalIndent(vars, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode variables: %w", err)
+	}
+
+	// CreateTemp always creates the file with mode 0600.
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return fmt.Errorf("cannot create variables file: %w", err)
+	}
+	this.variablesFile = f.Name()
+	defer func() {
+		if err := f.Close(); err != nil && rErr == nil {
+			rErr = fmt.Errorf("cannot write variables file %s: %w", f.Name(), err)
+		}
+	}()
+
+	if _, err := f.Write(encoded); err != nil {
+		return fmt.Errorf("cannot write variables file %s: %w", f.Name(), err)
+	}
+	log.With("file", f.Name()).
+		Debug("Variables written.")
+	return nil
+}
+
+// warnIfNotIgnoredByGit warns if the given file is inside a git repository
+// but not ignored by it. Although the file only exists while Terraform is
+// running, it must never be committed by accident.
+func warnIfNotIgnoredByGit(fn string) {
+	cmd := exec.Command("git", "check-ignore", "-q", filepath.Base(fn))
+	cmd.Dir = filepath.Dir(fn)
+	var eErr *exec.ExitError
+	// Exit code 1 means not ignored; everything else is either ignored, not
+	// a repository or git is not available.
+	if err := cmd.Run(); errors.As(err, &eErr) && eErr.ExitCode() == 1 {
+		log.With("file", fn).
+			With("pattern", autoTfvarsFilePattern).
+			Warn("Variables file is not ignored by git; add the pattern to .gitignore to never commit secrets by accident.")
+	}
+}
+
+func (this *Backend) removeVariablesFile() error {
+	fn, dir := this.variablesFile, this.variablesDir
+	this.variablesFile, this.variablesDir = "", ""
+	if fn != "" {
+		if err := os.Remove(fn); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove variables file %s: %w", fn, err)
+		}
+	}
+	if dir != "" {
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove directory of variables file %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// terraformArguments returns TerraformArgs extended by -var-file if the
+// variables were written into a file for it.
+func (this *Backend) terraformArguments() []string {
+	if this.variablesFile == "" || this.config.GetTerraform().GetVariablesMode() != TerraformVariablesModeVarFile || !this.terraformCommandAcceptsVarFile() {
+		return this.TerraformArgs
+	}
+	i := this.terraformCommandIndex()
+	result := make([]string, 0, len(this.TerraformArgs)+1)
+	result = append(result, this.TerraformArgs[:i+1]...)
+	result = append(result, "-var-file="+this.variablesFile)
+	return append(result, this.TerraformArgs[i+1:]...)
+}
+
+// terraformCommandIndex returns the index of the command inside of
+// TerraformArgs (the first argument after the global options) or -1 if there
+// is none.
+func (this *Backend) terraformCommandIndex() int {
+	for i, arg := range this.TerraformArgs {
+		if !strings.HasPrefix(arg, "-") {
+			return i
+		}
+	}
+	return -1
+}
+
+// terraformCommandAcceptsVarFile returns true if the command inside of
+// TerraformArgs is one of varFileCommands.
+func (this *Backend) terraformCommandAcceptsVarFile() bool {
+	i := this.terraformCommandIndex()
+	if i < 0 {
+		return false
+	}
+	_, ok := varFileCommands[this.TerraformArgs[i]]
+	return ok
+}
+
+// terraformWorkingDirectory returns the directory Terraform will work in,
+// respecting its global -chdir option.
+func (this *Backend) terraformWorkingDirectory() string {
+	for _, arg := range this.TerraformArgs {
+		if v := strings.TrimPrefix(arg, "-chdir="); v != arg {
+			return v
+		}
+		if !strings.HasPrefix(arg, "-") {
+			break
+		}
+	}
+	return "."
+}
+
+// encodeEnvironmentValue encodes the given value as Terraform expects it
+// inside of TF_VAR_*: strings as they are; everything else as JSON which is
+// also a valid HCL expression.
+func encodeEnvironmentValue(v interface{}) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
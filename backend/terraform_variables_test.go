@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"encoding/json"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBackend_provideTerraformVariables(t *testing.T) {
+	cases := []struct {
+		name string
+		mode TerraformVariablesMode
+		args []string
+		// expectedArgs contains <file> where the variables file is expected.
+		expectedArgs []string
+		inEnv        bool
+		inDir        bool
+	}{
+		{"environment", TerraformVariablesModeEnvironment, []string{"plan"}, []string{"plan"}, true, false},
+		{"default", "", []string{"plan"}, []string{"plan"}, true, false},
+		{"auto tfvars", TerraformVariablesModeAutoTfvars, []string{"plan"}, []string{"plan"}, false, true},
+		{"var file", TerraformVariablesModeVarFile, []string{"plan", "-out=plan.out"}, []string{"plan", "-var-file=<file>", "-out=plan.out"}, false, false},
+		{"var file with global options", TerraformVariablesModeVarFile, []string{"-chdir=.", "apply", "-auto-approve"}, []string{"-chdir=.", "apply", "-var-file=<file>", "-auto-approve"}, false, false},
+		{"var file with console", TerraformVariablesModeVarFile, []string{"console"}, []string{"console", "-var-file=<file>"}, false, false},
+		{"var file with other command", TerraformVariablesModeVarFile, []string{"output", "-json"}, []string{"output", "-json"}, true, false},
+		{"var file without command", TerraformVariablesModeVarFile, []string{"-version"}, []string{"-version"}, true, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			be, s := newFakeVaultBackend(t, `
+terraform {
+  variables = "`+c.mode.String()+`"
+}
+variable "db_password" {
+  name = "db"
+}
+variable "db_port" {
+  name  = "db"
+  field = "port"
+  type  = "number"
+}
+`)
+			sb, _ := s.Bitwarden()
+			if _, err := sb.CreateItem(bitwarden.Item{
+				Type:   bitwarden.ItemTypeLogin,
+				Name:   "db",
+				Login:  bitwarden.ItemLogin{Password: "secret"},
+				Fields: bitwarden.ItemFields{{Name: "port", Value: "5432"}},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			syncFakeVaultBackend(t, be)
+
+			be.TerraformArgs = c.args
+			if err := be.initializeConfigFor(false); err != nil {
+				t.Fatal(err)
+			}
+			b, err := be.newBitwarden()
+			if err != nil {
+				t.Fatal(err)
+			}
+			env := map[string]string{}
+			if err := be.provideTerraformVariables(b, env); err != nil {
+				t.Fatal(err)
+			}
+
+			expectedEnv := map[string]string{}
+			if c.inEnv {
+				expectedEnv = map[string]string{"TF_VAR_db_password": "secret", "TF_VAR_db_port": "5432"}
+				if be.variablesFile != "" {
+					t.Errorf("expected no variables file but got %s", be.variablesFile)
+				}
+			} else {
+				expected := map[string]interface{}{"db_password": "secret", "db_port": float64(5432)}
+				encoded, err := os.ReadFile(be.variablesFile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				actual := map[string]interface{}{}
+				if err := json.Unmarshal(encoded, &actual); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(actual, expected) {
+					t.Errorf("expected variables %v but got %v", expected, actual)
+				}
+				if fi, err := os.Stat(be.variablesFile); err != nil {
+					t.Fatal(err)
+				} else if fi.Mode().Perm() != 0600 {
+					t.Errorf("expected variables file to be only accessible by the owner but got %v", fi.Mode())
+				}
+				if dir, _ := filepath.Abs(filepath.Dir(be.variablesFile)); c.inDir != (dir == mustGetwd(t)) {
+					t.Errorf("expected variables file inside of the working directory to be %v but got %s", c.inDir, be.variablesFile)
+				}
+			}
+			if !reflect.DeepEqual(env, expectedEnv) {
+				t.Errorf("expected environment %v but got %v", expectedEnv, env)
+			}
+
+			var expectedArgs []string
+			for _, arg := range c.expectedArgs {
+				expectedArgs = append(expectedArgs, strings.ReplaceAll(arg, "<file>", be.variablesFile))
+			}
+			if actual := be.terraformArguments(); !reflect.DeepEqual(actual, expectedArgs) {
+				t.Errorf("expected arguments %v but got %v", expectedArgs, actual)
+			}
+
+			fn, dir := be.variablesFile, be.variablesDir
+			if err := be.removeVariablesFile(); err != nil {
+				t.Fatal(err)
+			}
+			for _, path := range []string{fn, dir} {
+				if _, err := os.Stat(path); path != "" && !os.IsNotExist(err) {
+					t.Errorf("expected %s to be removed but got %v", path, err)
+				}
+			}
+			if be.variablesFile != "" || be.variablesDir != "" {
+				t.Errorf("expected variables file to be forgotten but got %s (%s)", be.variablesFile, be.variablesDir)
+			}
+			// Removing it a second time has no effect.
+			if err := be.removeVariablesFile(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func mustGetwd(t *testing.T) string {
+	result, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VariableType defines how the plain value of a variable is converted before
+// it is handed over to Terraform.
+type VariableType string
+
+const (
+	VariableTypeString = VariableType("string")
+	VariableTypeNumber = VariableType("number")
+	VariableTypeBool   = VariableType("bool")
+	// VariableTypeJson accepts any JSON document.
+	VariableTypeJson = VariableType("json")
+	// VariableTypeList accepts either a JSON array or one element per line.
+	VariableTypeList = VariableType("list")
+	// VariableTypeMap accepts either a JSON object or one key=value per line.
+	VariableTypeMap = VariableType("map")
+)
+
+func (this VariableType) Validate() error {
+	switch this {
+	case "", VariableTypeString, VariableTypeNumber, VariableTypeBool, VariableTypeJson, VariableTypeList, VariableTypeMap:
+		return nil
+	default:
+		return fmt.Errorf("illegal type: '%s'", string(this))
+	}
+}
+
+func (this VariableType) String() string {
+	return string(this)
+}
+
+func (this VariableType) coerce(plain string) (interface{}, error) {
+	switch this {
+	case VariableTypeNumber:
+		var result interface{}
+		if err := decodeJsonValue(plain, &result); err != nil {
+			return nil, fmt.Errorf("not a valid number: '%s'", plain)
+		}
+		if _, ok := result.(json.Number); !ok {
+			return nil, fmt.Errorf("not a valid number: '%s'", plain)
+		}
+		return result, nil
+	case VariableTypeBool:
+		result, err := strconv.ParseBool(strings.TrimSpace(plain))
+		if err != nil {
+			return nil, fmt.Errorf("not a valid bool: '%s'", plain)
+		}
+		return result, nil
+	case VariableTypeJson:
+		var result interface{}
+		if err := decodeJsonValue(plain, &result); err != nil {
+			return nil, fmt.Errorf("not valid JSON: %w", err)
+		}
+		return result, nil
+	case VariableTypeList:
+		return this.coerceList(plain)
+	case VariableTypeMap:
+		return this.coerceMap(plain)
+	default:
+		return plain, nil
+	}
+}
+
+func (this VariableType) coerceList(plain string) (interface{}, error) {
+	trimmed := strings.TrimSpace(plain)
+	if strings.HasPrefix(trimmed, "[") {
+		var result []interface{}
+		if err := decodeJsonValue(trimmed, &result); err != nil {
+			return nil, fmt.Errorf("not a valid JSON array: %w", err)
+		}
+		return result, nil
+	}
+	result := []interface{}{}
+	for _, line := range strings.Split(trimmed, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			result = append(result, line)
+		}
+	}
+	return result, nil
+}
+
+func (this VariableType) coerceMap(plain string) (interface{}, error) {
+	trimmed := strings.TrimSpace(plain)
+	if strings.HasPrefix(trimmed, "{") {
+		var result map[string]interface{}
+		if err := decodeJsonValue(trimmed, &result); err != nil {
+			return nil, fmt.Errorf("not a valid JSON object: %w", err)
+		}
+		return result, nil
+	}
+	result := map[string]interface{}{}
+	for i, line := range strings.Split(trimmed, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("line %d is not a key=value pair", i+1)
+		}
+		result[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return result, nil
+}
+
+// decodeJsonValue decodes the given JSON and keeps numbers as they are to
+// not lose precision of large numbers.
+func decodeJsonValue(plain string, to interface{}) error {
+	d := json.NewDecoder(bytes.NewReader([]byte(plain)))
+	d.UseNumber()
+	if err := d.Decode(to); err != nil {
+		return err
+	}
+	if d.More() {
+		return fmt.Errorf("unexpected content after JSON value")
+	}
+	return nil
+}
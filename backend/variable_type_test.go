@@ -0,0 +1,82 @@
+package backend
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVariableType_coerce(t *testing.T) {
+	cases := []struct {
+		name     string
+		typ      VariableType
+		plain    string
+		expected interface{}
+		err      string
+	}{
+		{"default", "", " a\n", " a\n", ""},
+		{"string", VariableTypeString, "1", "1", ""},
+
+		{"number", VariableTypeNumber, "42", json.Number("42"), ""},
+		{"number with spaces", VariableTypeNumber, " -1.5e3\n", json.Number("-1.5e3"), ""},
+		{"number large", VariableTypeNumber, "12345678901234567890123", json.Number("12345678901234567890123"), ""},
+		{"number invalid", VariableTypeNumber, "abc", nil, "not a valid number: 'abc'"},
+		{"number quoted", VariableTypeNumber, `"1"`, nil, `not a valid number: '"1"'`},
+		{"number trailing content", VariableTypeNumber, "1 2", nil, "not a valid number: '1 2'"},
+		{"number empty", VariableTypeNumber, "", nil, "not a valid number: ''"},
+
+		{"bool true", VariableTypeBool, "true", true, ""},
+		{"bool false with spaces", VariableTypeBool, " false\n", false, ""},
+		{"bool numeric", VariableTypeBool, "1", true, ""},
+		{"bool invalid", VariableTypeBool, "yes", nil, "not a valid bool: 'yes'"},
+		{"bool empty", VariableTypeBool, "", nil, "not a valid bool: ''"},
+
+		{"json object", VariableTypeJson, `{"a":[1,true,null]}`, map[string]interface{}{"a": []interface{}{json.Number("1"), true, nil}}, ""},
+		{"json string", VariableTypeJson, `"a"`, "a", ""},
+		{"json invalid", VariableTypeJson, `{"a":`, nil, "not valid JSON: unexpected EOF"},
+		{"json trailing content", VariableTypeJson, `{} {}`, nil, "not valid JSON: unexpected content after JSON value"},
+
+		{"list json", VariableTypeList, ` ["a", 1] `, []interface{}{"a", json.Number("1")}, ""},
+		{"list lines", VariableTypeList, "a\n\n  b  \n", []interface{}{"a", "b"}, ""},
+		{"list empty", VariableTypeList, "", []interface{}{}, ""},
+		{"list invalid json", VariableTypeList, `["a",`, nil, "not a valid JSON array: unexpected EOF"},
+		{"list json object", VariableTypeList, `[{"a":1}`, nil, "not a valid JSON array:"},
+
+		{"map json", VariableTypeMap, `{"a": "b", "c": 1}`, map[string]interface{}{"a": "b", "c": json.Number("1")}, ""},
+		{"map lines", VariableTypeMap, "a = b\n\nc=d=e\n", map[string]interface{}{"a": "b", "c": "d=e"}, ""},
+		{"map empty", VariableTypeMap, "", map[string]interface{}{}, ""},
+		{"map empty value", VariableTypeMap, "a=", map[string]interface{}{"a": ""}, ""},
+		{"map invalid json", VariableTypeMap, `{"a":}`, nil, "not a valid JSON object:"},
+		{"map missing equals", VariableTypeMap, "a=b\nc", nil, "line 2 is not a key=value pair"},
+		{"map empty key", VariableTypeMap, " = b", nil, "line 1 is not a key=value pair"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := c.typ.coerce(c.plain)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected error containing %q but got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Errorf("expected %#v but got %#v", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestVariableType_Validate(t *testing.T) {
+	for _, typ := range []VariableType{"", VariableTypeString, VariableTypeNumber, VariableTypeBool, VariableTypeJson, VariableTypeList, VariableTypeMap} {
+		if err := typ.Validate(); err != nil {
+			t.Errorf("%q: unexpected error %v", typ, err)
+		}
+	}
+	if err := VariableType("int").Validate(); err == nil {
+		t.Error("expected type int to be invalid")
+	}
+}
@@ -0,0 +1,466 @@
+package backend
+
+import (
+	"fmt"
+	log "github.com/echocat/slf4g"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultWorkspace     = "default"
+	workspacePlaceholder = "{workspace}"
+	itemNamePlaceholder  = "{item_name}"
+)
+
+var (
+	workspaceNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+)
+
+// currentWorkspace detects the workspace selected by the user in the same way
+// as Terraform does it: TF_WORKSPACE wins over .terraform/environment.
+func currentWorkspace() (string, error) {
+	if v := os.Getenv("TF_WORKSPACE"); v != "" {
+		return v, nil
+	}
+	b, err := os.ReadFile(workspaceEnvironmentFile())
+	if os.IsNotExist(err) {
+		return defaultWorkspace, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot read current workspace: %w", err)
+	}
+	if v := strings.TrimSpace(string(b)); v != "" {
+		return v, nil
+	}
+	return defaultWorkspace, nil
+}
+
+func selectWorkspace(name string) error {
+	fn := workspaceEnvironmentFile()
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return fmt.Errorf("cannot select workspace %s: %w", name, err)
+	}
+	if err := os.WriteFile(fn, []byte(name), 0644); err != nil {
+		return fmt.Errorf("cannot select workspace %s: %w", name, err)
+	}
+	return nil
+}
+
+func workspaceEnvironmentFile() string {
+	dir := os.Getenv("TF_DATA_DIR")
+	if dir == "" {
+		dir = ".terraform"
+	}
+	return filepath.Join(dir, "environment")
+}
+
+func validateWorkspaceName(name string) error {
+	if !workspaceNameRegex.MatchString(name) {
+		return fmt.Errorf("illegal workspace name: '%s'", name)
+	}
+	return nil
+}
+
+// StoreRefOfWorkspace returns the reference to the state of the given
+// workspace. If workspace_attachment_prefix is set, all workspaces share the
+// item of the default workspace; otherwise every workspace other than the
+// default one has its own item named by workspace_item_name.
+func (this ConfigState) StoreRefOfWorkspace(workspace string) (StoreRef, error) {
+	if workspace == "" || workspace == defaultWorkspace {
+		// If both are set, item_id identifies the item of the default
+		// workspace while item_name is still used to name the items of all
+		// other workspaces.
+		if this.ItemName == "" && this.ItemId == "" {
+			return StoreRef{}, fmt.Errorf("state: one attribute of item_name or item_id ref is required")
+		}
+		return StoreRef{ItemId: this.ItemId, ItemName: this.ItemName}, nil
+	}
+	if err := validateWorkspaceName(workspace); err != nil {
+		return StoreRef{}, err
+	}
+	if prefix := this.WorkspaceAttachmentPrefix; prefix != "" {
+		result, err := this.StoreRefOfWorkspace(defaultWorkspace)
+		if err != nil {
+			return StoreRef{}, err
+		}
+		result.AttachmentPrefix = strings.ReplaceAll(prefix, workspacePlaceholder, workspace)
+		return result, nil
+	}
+	if this.ItemName == "" {
+		return StoreRef{}, fmt.Errorf("state: workspaces other than %s require item_name to be set", defaultWorkspace)
+	}
+	return StoreRef{ItemName: strings.NewReplacer(
+		itemNamePlaceholder, this.ItemName,
+		workspacePlaceholder, workspace,
+	).Replace(this.GetWorkspaceItemName())}, nil
+}
+
+func (this ConfigState) WorkspaceOfItemName(name string) (string, bool) {
+	// The item name itself might contain the placeholder; so the template is
+	// split before the item name is inserted.
+	tmpl := this.GetWorkspaceItemName()
+	i := strings.Index(tmpl, workspacePlaceholder)
+	if i < 0 {
+		return "", false
+	}
+	replacer := strings.NewReplacer(itemNamePlaceholder, this.ItemName)
+	prefix, suffix := replacer.Replace(tmpl[:i]), replacer.Replace(tmpl[i+len(workspacePlaceholder):])
+	if len(name) <= len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	workspace := name[len(prefix) : len(name)-len(suffix)]
+	if validateWorkspaceName(workspace) != nil || workspace == defaultWorkspace {
+		return "", false
+	}
+	if ref, err := this.StoreRefOfWorkspace(workspace); err != nil || ref.ItemName != name {
+		return "", false
+	}
+	return workspace, true
+}
+
+// WorkspaceOfAttachmentName returns the workspace the given attachment belongs
+// to if workspace_attachment_prefix is set. Because workspace names might
+// contain the separators of the prefix, the workspace is only accepted if the
+// remaining name is one of the attachments written by the store.
+func (this ConfigState) WorkspaceOfAttachmentName(fn string) (string, bool) {
+	tmpl := this.WorkspaceAttachmentPrefix
+	i := strings.Index(tmpl, workspacePlaceholder)
+	if i < 0 {
+		return "", false
+	}
+	prefix := tmpl[:i]
+	if !strings.HasPrefix(fn, prefix) {
+		return "", false
+	}
+	for end := len(prefix) + 1; end < len(fn); end++ {
+		workspace := fn[len(prefix):end]
+		if validateWorkspaceName(workspace) != nil {
+			break
+		}
+		if workspace == defaultWorkspace {
+			continue
+		}
+		ref, err := this.StoreRefOfWorkspace(workspace)
+		if err != nil {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(fn, ref.AttachmentPrefix); ok && isStoreAttachmentFileName(rest) {
+			return workspace, true
+		}
+	}
+	return "", false
+}
+
+type workspaceCommands struct {
+	*Backend
+
+	name  string
+	force bool
+}
+
+func (this *workspaceCommands) register(app *kingpin.Application) {
+	cmd := app.Command("workspace", "Manages workspaces which are stored as separate items in Bitwarden.")
+
+	cmd.Command("list", "Lists all existing workspaces.").
+		Action(this.cmdList)
+	cmd.Command("show", "Shows the name of the current workspace.").
+		Action(this.cmdShow)
+
+	newCmd := cmd.Command("new", "Creates a new workspace and selects it.").
+		Action(this.cmdNew)
+	newCmd.Arg("name", "Name of the workspace to create.").
+		Required().
+		StringVar(&this.name)
+
+	selectCmd := cmd.Command("select", "Selects an existing workspace.").
+		Action(this.cmdSelect)
+	selectCmd.Arg("name", "Name of the workspace to select.").
+		Required().
+		StringVar(&this.name)
+
+	deleteCmd := cmd.Command("delete", "Deletes an existing workspace (moves its item into the trash of Bitwarden).").
+		Action(this.cmdDelete)
+	deleteCmd.Arg("name", "Name of the workspace to delete.").
+		Required().
+		StringVar(&this.name)
+	deleteCmd.Flag("force", "Deletes the workspace even if it still contains a state.").
+		BoolVar(&this.force)
+}
+
+func (this *workspaceCommands) cmdList(*kingpin.ParseContext) error {
+	return this.withClient(func(b *bitwarden.Bitwarden) error {
+		sc := this.config.GetState()
+		workspaces := []string{defaultWorkspace}
+		if sc.WorkspaceAttachmentPrefix != "" {
+			found, err := this.workspacesOfAttachments(b)
+			if err != nil {
+				return err
+			}
+			workspaces = append(workspaces, found...)
+		} else if sc.ItemName != "" {
+			if err := b.Sync(); err != nil {
+				return err
+			}
+			// No workspace can exist if its folder or collection does not.
+			folderId, collectionId, err := (&Store{StoreParent: this.Backend}).itemScopeOf(b)
+			if err != nil && err != bitwarden.ErrNoSuchItem {
+				return err
+			}
+			if err == nil {
+				items, err := b.FindItems(bitwarden.ItemsQuery{
+					Search:         sc.ItemName,
+					OrganizationId: sc.OrganizationId,
+					CollectionId:   collectionId,
+					FolderId:       folderId,
+				})
+				if err != nil {
+					return err
+				}
+				for _, item := range items {
+					if workspace, ok := sc.WorkspaceOfItemName(item.Name); ok {
+						workspaces = append(workspaces, workspace)
+					}
+				}
+			}
+		}
+		sort.Strings(workspaces[1:])
+
+		for _, workspace := range workspaces {
+			if workspace == this.workspace {
+				fmt.Printf("* %s\n", workspace)
+			} else {
+				fmt.Printf("  %s\n", workspace)
+			}
+		}
+		return nil
+	})
+}
+
+func (this *workspaceCommands) cmdShow(*kingpin.ParseContext) error {
+	if err := this.initializeConfig(); err != nil {
+		return err
+	}
+	fmt.Println(this.workspace)
+	return nil
+}
+
+func (this *workspaceCommands) cmdNew(*kingpin.ParseContext) error {
+	return this.withClient(func(b *bitwarden.Bitwarden) error {
+		sc := this.config.GetState()
+		ref, err := sc.StoreRefOfWorkspace(this.name)
+		if err != nil {
+			return err
+		}
+		if this.name == defaultWorkspace {
+			return fmt.Errorf("workspace %s already exists", this.name)
+		}
+
+		if ref.AttachmentPrefix != "" {
+			return this.newWorkspaceInAttachments(b, ref)
+		}
+
+		item, err := this.findWorkspaceItem(b, ref)
+		if err == nil {
+			return fmt.Errorf("workspace %s already exists as item %s (%s)", this.name, item.Name, item.Id)
+		}
+		if err != bitwarden.ErrNoSuchItem {
+			return err
+		}
+
+		created, err := (&Store{StoreParent: this.Backend}).createItem(b, ref.String())
+		if err != nil {
+			return err
+		}
+		log.With("workspace", this.name).
+			With("itemName", created.Name).
+			With("itemId", created.Id).
+			Info("Workspace created.")
+
+		return this.selectWorkspace(this.name)
+	})
+}
+
+func (this *workspaceCommands) cmdSelect(*kingpin.ParseContext) error {
+	if this.name == defaultWorkspace {
+		if err := this.initializeConfig(); err != nil {
+			return err
+		}
+		return this.selectWorkspace(this.name)
+	}
+	return this.withClient(func(b *bitwarden.Bitwarden) error {
+		ref, err := this.config.GetState().StoreRefOfWorkspace(this.name)
+		if err != nil {
+			return err
+		}
+		if _, err := this.findWorkspaceItem(b, ref); err == bitwarden.ErrNoSuchItem {
+			return fmt.Errorf("workspace %s does not exist", this.name)
+		} else if err != nil {
+			return err
+		}
+		return this.selectWorkspace(this.name)
+	})
+}
+
+func (this *workspaceCommands) cmdDelete(*kingpin.ParseContext) error {
+	return this.withClient(func(b *bitwarden.Bitwarden) error {
+		if this.name == defaultWorkspace {
+			return fmt.Errorf("workspace %s cannot be deleted", defaultWorkspace)
+		}
+		if this.name == this.workspace {
+			return fmt.Errorf("workspace %s is currently selected and cannot be deleted", this.name)
+		}
+		ref, err := this.config.GetState().StoreRefOfWorkspace(this.name)
+		if err != nil {
+			return err
+		}
+		item, err := this.findWorkspaceItem(b, ref)
+		if err == bitwarden.ErrNoSuchItem {
+			return fmt.Errorf("workspace %s does not exist", this.name)
+		} else if err != nil {
+			return err
+		}
+		if ref.AttachmentPrefix != "" {
+			if ok, err := this.workspaceExistsInAttachments(b, this.name); err != nil {
+				return err
+			} else if !ok {
+				return fmt.Errorf("workspace %s does not exist", this.name)
+			}
+		}
+
+		s := (&Store{StoreParent: this.Backend}).scopedTo(ref.String())
+		revs, err := s.stateRevisionsOf(item)
+		if err != nil {
+			return err
+		}
+		if len(revs) > 0 && !this.force {
+			return fmt.Errorf("workspace %s still contains a state; use --force to delete it anyway", this.name)
+		}
+
+		if ref.AttachmentPrefix != "" {
+			return this.deleteWorkspaceAttachments(b, s, ref.String())
+		}
+
+		if err := b.DeleteItem(*item); err != nil {
+			return err
+		}
+		log.With("workspace", this.name).
+			With("itemName", item.Name).
+			With("itemId", item.Id).
+			Info("Workspace deleted.")
+		return nil
+	})
+}
+
+// newWorkspaceInAttachments creates a workspace which shares its item with the
+// other workspaces. There is nothing to create besides the shared item itself;
+// the workspace exists as soon as its first state is written.
+func (this *workspaceCommands) newWorkspaceInAttachments(b *bitwarden.Bitwarden, ref StoreRef) error {
+	if ok, err := this.workspaceExistsInAttachments(b, this.name); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("workspace %s already exists", this.name)
+	}
+
+	shared := StoreRef{ItemId: ref.ItemId, ItemName: ref.ItemName}
+	item, err := this.findWorkspaceItem(b, shared)
+	if err == bitwarden.ErrNoSuchItem {
+		item, err = (&Store{StoreParent: this.Backend}).createItem(b, shared.String())
+	}
+	if err != nil {
+		return err
+	}
+	log.With("workspace", this.name).
+		With("itemName", item.Name).
+		With("itemId", item.Id).
+		With("attachmentPrefix", ref.AttachmentPrefix).
+		Info("Workspace created.")
+
+	return this.selectWorkspace(this.name)
+}
+
+// workspacesOfAttachments returns all workspaces which have at least one
+// attachment inside of the shared item.
+func (this *workspaceCommands) workspacesOfAttachments(b *bitwarden.Bitwarden) ([]string, error) {
+	sc := this.config.GetState()
+	ref, err := sc.StoreRefOfWorkspace(defaultWorkspace)
+	if err != nil {
+		return nil, err
+	}
+	item, err := this.findWorkspaceItem(b, ref)
+	if err == bitwarden.ErrNoSuchItem {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	seen := map[string]bool{}
+	for _, aref := range item.AttachmentReferences {
+		if workspace, ok := sc.WorkspaceOfAttachmentName(aref.FileName); ok && !seen[workspace] {
+			seen[workspace] = true
+			result = append(result, workspace)
+		}
+	}
+	return result, nil
+}
+
+func (this *workspaceCommands) workspaceExistsInAttachments(b *bitwarden.Bitwarden, name string) (bool, error) {
+	workspaces, err := this.workspacesOfAttachments(b)
+	if err != nil {
+		return false, err
+	}
+	for _, candidate := range workspaces {
+		if candidate == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// deleteWorkspaceAttachments deletes all states, the lock and the record of a
+// broken lock of a workspace which shares its item with other workspaces.
+func (this *workspaceCommands) deleteWorkspaceAttachments(b *bitwarden.Bitwarden, s *Store, ref string) error {
+	if err := s.DeleteState(ref); err != nil {
+		return err
+	}
+	if err := s.DeleteLock(ref); err != nil {
+		return err
+	}
+	item, err := s.getItem(b, ref)
+	if err != nil {
+		return err
+	}
+	if broken, err := s.brokenLockOf(item); err != nil {
+		return err
+	} else if broken != nil {
+		if err := s.setHiddenField(b, item, brokenLockFieldName, ""); err != nil {
+			return err
+		}
+	}
+
+	log.With("workspace", this.name).
+		With("itemName", item.Name).
+		With("itemId", item.Id).
+		With("attachmentPrefix", s.attachmentPrefix).
+		Info("Workspace deleted.")
+	return nil
+}
+
+func (this *workspaceCommands) findWorkspaceItem(b *bitwarden.Bitwarden, ref StoreRef) (*bitwarden.Item, error) {
+	return (&Store{StoreParent: this.Backend}).getItem(b, ref.String())
+}
+
+func (this *workspaceCommands) selectWorkspace(name string) error {
+	if err := selectWorkspace(name); err != nil {
+		return err
+	}
+	fmt.Printf("Switched to workspace %q.\n", name)
+	return nil
+}
@@ -0,0 +1,230 @@
+package backend
+
+import (
+	"errors"
+	"github.com/bhoriuchi/terraform-backend-http/go/store"
+	"github.com/bhoriuchi/terraform-backend-http/go/types"
+	"testing"
+)
+
+func TestConfigState_StoreRefOfWorkspace_itemName(t *testing.T) {
+	cases := []struct {
+		name      string
+		config    ConfigState
+		workspace string
+		expected  string
+	}{
+		{"default template", ConfigState{ItemName: "state"}, "dev", "state-dev"},
+		{"workspace with separator", ConfigState{ItemName: "state"}, "dev-eu.1", "state-dev-eu.1"},
+		{"item name with separator", ConfigState{ItemName: "my-state"}, "my-dev", "my-state-my-dev"},
+		{"workspace first", ConfigState{ItemName: "state", WorkspaceItemName: "{workspace}.{item_name}"}, "a.b", "a.b.state"},
+		{"without item name", ConfigState{ItemName: "state", WorkspaceItemName: "tf/{workspace}"}, "dev", "tf/dev"},
+		{"item name with placeholders", ConfigState{ItemName: "{workspace}-{item_name}"}, "dev", "{workspace}-{item_name}-dev"},
+		{"default workspace", ConfigState{ItemName: "state", ItemId: "0b7b1c6e-0000-0000-0000-000000000000"}, defaultWorkspace, "state"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ref, err := c.config.StoreRefOfWorkspace(c.workspace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ref.ItemName != c.expected || ref.AttachmentPrefix != "" {
+				t.Fatalf("expected item %q but got %+v", c.expected, ref)
+			}
+			if c.workspace == defaultWorkspace {
+				if ref.ItemId != c.config.ItemId {
+					t.Errorf("expected item ID %q but got %+v", c.config.ItemId, ref)
+				}
+				if _, ok := c.config.WorkspaceOfItemName(ref.ItemName); ok {
+					t.Errorf("item %q of the default workspace recognized as other workspace", ref.ItemName)
+				}
+				return
+			}
+			if actual, ok := c.config.WorkspaceOfItemName(ref.ItemName); !ok || actual != c.workspace {
+				t.Errorf("expected workspace %q of item %q but got %q (%v)", c.workspace, ref.ItemName, actual, ok)
+			}
+		})
+	}
+}
+
+func TestConfigState_WorkspaceOfItemName_foreign(t *testing.T) {
+	config := ConfigState{ItemName: "state"}
+	for _, name := range []string{"state", "state-", "other-dev", "state-dev/x", "state-default"} {
+		if actual, ok := config.WorkspaceOfItemName(name); ok {
+			t.Errorf("expected %q to belong to no workspace but got %q", name, actual)
+		}
+	}
+}
+
+func TestConfigState_StoreRefOfWorkspace_errors(t *testing.T) {
+	cases := []struct {
+		name      string
+		config    ConfigState
+		workspace string
+	}{
+		{"no item", ConfigState{}, defaultWorkspace},
+		{"illegal workspace", ConfigState{ItemName: "state"}, "a/b"},
+		{"template delimiter in workspace", ConfigState{ItemName: "state"}, "{workspace}"},
+		{"item id only", ConfigState{ItemId: "0b7b1c6e-0000-0000-0000-000000000000"}, "dev"},
+		{"attachment prefix without item", ConfigState{WorkspaceAttachmentPrefix: "{workspace}."}, "dev"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if ref, err := c.config.StoreRefOfWorkspace(c.workspace); err == nil {
+				t.Errorf("expected error but got %+v", ref)
+			}
+		})
+	}
+}
+
+func TestConfigState_StoreRefOfWorkspace_attachmentPrefix(t *testing.T) {
+	const stateFile = "terraform-state-2024-01-02T03-04-05.000000.json"
+	cases := []struct {
+		name      string
+		config    ConfigState
+		workspace string
+		expected  string
+	}{
+		{"suffix separator", ConfigState{ItemName: "state", WorkspaceAttachmentPrefix: "{workspace}."}, "dev", "dev."},
+		{"workspace with separator", ConfigState{ItemName: "state", WorkspaceAttachmentPrefix: "{workspace}."}, "dev.eu.1", "dev.eu.1."},
+		{"surrounding", ConfigState{ItemId: "0b7b1c6e-0000-0000-0000-000000000000", WorkspaceAttachmentPrefix: "ws-{workspace}-"}, "a-b-", "ws-a-b--"},
+		{"workspace named like a state", ConfigState{ItemName: "state", WorkspaceAttachmentPrefix: "{workspace}."}, "terraform-state-2024", "terraform-state-2024."},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.config.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			ref, err := c.config.StoreRefOfWorkspace(c.workspace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ref.AttachmentPrefix != c.expected || ref.ItemName != c.config.ItemName || ref.ItemId != c.config.ItemId {
+				t.Fatalf("expected shared item with prefix %q but got %+v", c.expected, ref)
+			}
+
+			var parsed StoreRef
+			if err := parsed.Set(ref.String()); err != nil {
+				t.Fatal(err)
+			}
+			if parsed != ref {
+				t.Errorf("expected %+v after parsing %q but got %+v", ref, ref.String(), parsed)
+			}
+
+			for _, fn := range []string{stateFile, lockAttachmentFileName, "terraform-state-2024-01-02T03-04-05.000000.part-0001", "terraform-state-2024-01-02T03-04-05.000000.meta.json"} {
+				if actual, ok := c.config.WorkspaceOfAttachmentName(ref.AttachmentPrefix + fn); !ok || actual != c.workspace {
+					t.Errorf("expected workspace %q of attachment %q but got %q (%v)", c.workspace, ref.AttachmentPrefix+fn, actual, ok)
+				}
+			}
+			for _, fn := range []string{stateFile, lockAttachmentFileName, ref.AttachmentPrefix + "notes.txt", "notes.txt"} {
+				if actual, ok := c.config.WorkspaceOfAttachmentName(fn); ok {
+					t.Errorf("expected attachment %q to belong to no other workspace but got %q", fn, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigState_Validate_workspaceAttachmentPrefix(t *testing.T) {
+	for _, config := range []ConfigState{
+		{WorkspaceAttachmentPrefix: "dev."},
+		{WorkspaceAttachmentPrefix: "{workspace}:"},
+		{WorkspaceAttachmentPrefix: "{workspace}/"},
+		{WorkspaceAttachmentPrefix: "{workspace}.", WorkspaceItemName: "{item_name}-{workspace}"},
+		{WorkspaceAttachmentPrefix: "{workspace}.", Storage: StateStorageNotes},
+	} {
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", config)
+		}
+	}
+}
+
+func TestStoreRef_Set(t *testing.T) {
+	cases := []struct {
+		plain    string
+		expected StoreRef
+	}{
+		{"", StoreRef{}},
+		{"id:abc", StoreRef{ItemId: "abc"}},
+		{"name:a:b", StoreRef{ItemName: "a:b"}},
+		{"name:prefix:a", StoreRef{ItemName: "prefix:a"}},
+		{"prefix:dev.:name:a:b", StoreRef{ItemName: "a:b", AttachmentPrefix: "dev."}},
+		{"prefix:dev.:id:abc", StoreRef{ItemId: "abc", AttachmentPrefix: "dev."}},
+	}
+	for _, c := range cases {
+		t.Run(c.plain, func(t *testing.T) {
+			var actual StoreRef
+			if err := actual.Set(c.plain); err != nil {
+				t.Fatal(err)
+			}
+			if actual != c.expected {
+				t.Errorf("expected %+v but got %+v", c.expected, actual)
+			}
+			if actual.String() != c.plain {
+				t.Errorf("expected %q but got %q", c.plain, actual.String())
+			}
+		})
+	}
+	for _, plain := range []string{"foo", "prefix:dev.", "prefix::name:a", "prefix:dev.:foo:a"} {
+		var actual StoreRef
+		if err := actual.Set(plain); !errors.Is(err, ErrIllegalStoreRef) {
+			t.Errorf("%q: expected illegal store ref but got %v", plain, err)
+		}
+	}
+}
+
+func TestStore_attachmentPrefix_separatesWorkspaces(t *testing.T) {
+	s := newFakeVaultClients(t, ConfigState{}, 1)[0]
+	shared := StoreRef{ItemName: "terraform-state"}
+	dev := StoreRef{ItemName: shared.ItemName, AttachmentPrefix: "dev."}
+
+	if err := s.PutState(shared.String(), concurrencyTestState(1, 0), nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.GetState(dev.String()); err != store.ErrNotFound {
+		t.Fatalf("expected no state in workspace dev but got %v", err)
+	}
+	if err := s.PutState(dev.String(), concurrencyTestState(1, 1), nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutLock(dev.String(), types.Lock{ID: "dev-lock"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for ref, client := range map[StoreRef]float64{shared: 0, dev: 1} {
+		state, _, err := s.GetState(ref.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state["client"] != client {
+			t.Errorf("%v: expected state of client %v but got %v", ref, client, state)
+		}
+	}
+	if _, err := s.GetLock(shared.String()); err != store.ErrNotFound {
+		t.Errorf("expected lock of workspace dev not to lock the shared state but got %v", err)
+	}
+
+	if err := s.DeleteState(dev.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteLock(dev.String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.GetState(dev.String()); err != store.ErrNotFound {
+		t.Errorf("expected state of workspace dev to be deleted but got %v", err)
+	}
+	if _, _, err := s.GetState(shared.String()); err != nil {
+		t.Errorf("expected state of the default workspace to be kept but got %v", err)
+	}
+
+	sb, _ := s.Bitwarden()
+	item, err := s.getItem(sb, shared.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, aref := range item.AttachmentReferences {
+		if _, ok := (&Store{attachmentPrefix: dev.AttachmentPrefix}).fileNameOf(aref); ok {
+			t.Errorf("attachment %s of workspace dev was not deleted", aref.FileName)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package bitwarden
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type AmbiguityPolicy string
+
+const (
+	AmbiguityPolicyError              = AmbiguityPolicy("error")
+	AmbiguityPolicyNewestRevision     = AmbiguityPolicy("newest_revision")
+	AmbiguityPolicyOldestRevision     = AmbiguityPolicy("oldest_revision")
+	AmbiguityPolicyPreferOrganization = AmbiguityPolicy("prefer_organization")
+	AmbiguityPolicyPreferPersonal     = AmbiguityPolicy("prefer_personal")
+)
+
+var (
+	ErrIllegalAmbiguityPolicy = errors.New("illegal ambiguity policy")
+
+	AllAmbiguityPolicies = []AmbiguityPolicy{
+		AmbiguityPolicyError,
+		AmbiguityPolicyNewestRevision,
+		AmbiguityPolicyOldestRevision,
+		AmbiguityPolicyPreferOrganization,
+		AmbiguityPolicyPreferPersonal,
+	}
+)
+
+func (this AmbiguityPolicy) Validate() error {
+	if this == "" {
+		return nil
+	}
+	for _, candidate := range AllAmbiguityPolicies {
+		if this == candidate {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrIllegalAmbiguityPolicy, string(this))
+}
+
+// Resolve selects exactly one item of the given candidates. If this is not
+// possible an ItemNotUniqueError is returned which contains all remaining
+// candidates.
+func (this AmbiguityPolicy) Resolve(candidates Items) (*Item, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoSuchItem
+	}
+	if len(candidates) == 1 {
+		return &candidates[0], nil
+	}
+
+	switch this {
+	case AmbiguityPolicyNewestRevision, AmbiguityPolicyOldestRevision:
+		var buf Items
+		for _, candidate := range candidates {
+			if len(buf) == 0 || this.isPreferredRevision(candidate, buf[0]) {
+				buf = Items{candidate}
+			} else if sameRevisionDate(candidate, buf[0]) {
+				// Candidates of the same revision are still ambiguous.
+				buf = append(buf, candidate)
+			}
+		}
+		if len(buf) == 1 {
+			return &buf[0], nil
+		}
+		candidates = buf
+	case AmbiguityPolicyPreferOrganization, AmbiguityPolicyPreferPersonal:
+		var buf Items
+		for _, candidate := range candidates {
+			if (candidate.OrganizationId != nil) == (this == AmbiguityPolicyPreferOrganization) {
+				buf = append(buf, candidate)
+			}
+		}
+		if len(buf) == 1 {
+			return &buf[0], nil
+		}
+		if len(buf) > 1 {
+			candidates = buf
+		}
+	}
+
+	return nil, &ItemNotUniqueError{Candidates: candidates}
+}
+
+// ResolveAttachment selects exactly one attachment of the given candidates.
+// Attachments carry neither a revision date nor an organization; so no
+// AmbiguityPolicy can prefer one of several candidates and an
+// AttachmentNotUniqueError is returned instead.
+func ResolveAttachment(candidates ItemAttachmentReferences) (*ItemAttachmentReference, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoSuchAttachment
+	}
+	if len(candidates) == 1 {
+		return &candidates[0], nil
+	}
+	return nil, &AttachmentNotUniqueError{Candidates: candidates}
+}
+
+func (this AmbiguityPolicy) isPreferredRevision(candidate, current Item) bool {
+	if candidate.RevisionDate == nil {
+		return false
+	}
+	if current.RevisionDate == nil {
+		return true
+	}
+	if this == AmbiguityPolicyOldestRevision {
+		return candidate.RevisionDate.Before(*current.RevisionDate)
+	}
+	return candidate.RevisionDate.After(*current.RevisionDate)
+}
+
+func sameRevisionDate(a, b Item) bool {
+	if a.RevisionDate == nil || b.RevisionDate == nil {
+		return a.RevisionDate == nil && b.RevisionDate == nil
+	}
+	return a.RevisionDate.Equal(*b.RevisionDate)
+}
+
+func (this AmbiguityPolicy) String() string {
+	if this == "" {
+		return string(AmbiguityPolicyError)
+	}
+	return string(this)
+}
+
+type ItemNotUniqueError struct {
+	Candidates Items
+}
+
+func (this *ItemNotUniqueError) Ids() []string {
+	result := make([]string, len(this.Candidates))
+	for i, candidate := range this.Candidates {
+		result[i] = candidate.Id
+	}
+	return result
+}
+
+func (this *ItemNotUniqueError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrItemNotUnique, strings.Join(this.Ids(), ", "))
+}
+
+func (this *ItemNotUniqueError) Unwrap() error {
+	return ErrItemNotUnique
+}
+
+type AttachmentNotUniqueError struct {
+	Candidates ItemAttachmentReferences
+}
+
+func (this *AttachmentNotUniqueError) Ids() []string {
+	result := make([]string, len(this.Candidates))
+	for i, candidate := range this.Candidates {
+		result[i] = candidate.Id
+	}
+	return result
+}
+
+func (this *AttachmentNotUniqueError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrAttachmentNotUnique, strings.Join(this.Ids(), ", "))
+}
+
+func (this *AttachmentNotUniqueError) Unwrap() error {
+	return ErrAttachmentNotUnique
+}
@@ -0,0 +1,112 @@
+package bitwarden
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAmbiguityPolicy_Resolve(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	org := "org"
+	item := func(id string, revisionDate *time.Time, organizationId *string) Item {
+		return Item{Id: id, RevisionDate: revisionDate, OrganizationId: organizationId}
+	}
+	a := item("a", &older, nil)
+	b := item("b", &newer, &org)
+	c := item("c", &newer, nil)
+	d := item("d", nil, &org)
+
+	cases := []struct {
+		name       string
+		policy     AmbiguityPolicy
+		candidates Items
+		expected   string
+		ambiguous  []string
+		err        error
+	}{
+		{"none", AmbiguityPolicyError, nil, "", nil, ErrNoSuchItem},
+		{"none newest revision", AmbiguityPolicyNewestRevision, Items{}, "", nil, ErrNoSuchItem},
+		{"unique", AmbiguityPolicyError, Items{a}, "a", nil, nil},
+		{"unique newest revision", AmbiguityPolicyNewestRevision, Items{d}, "d", nil, nil},
+		{"default", "", Items{a, b}, "", []string{"a", "b"}, ErrItemNotUnique},
+		{"error", AmbiguityPolicyError, Items{a, b}, "", []string{"a", "b"}, ErrItemNotUnique},
+		{"newest revision", AmbiguityPolicyNewestRevision, Items{a, b}, "b", nil, nil},
+		{"newest revision without date", AmbiguityPolicyNewestRevision, Items{d, a}, "a", nil, nil},
+		{"newest revision equal dates", AmbiguityPolicyNewestRevision, Items{a, b, c}, "", []string{"b", "c"}, ErrItemNotUnique},
+		{"newest revision all without date", AmbiguityPolicyNewestRevision, Items{d, item("e", nil, nil)}, "", []string{"d", "e"}, ErrItemNotUnique},
+		{"oldest revision", AmbiguityPolicyOldestRevision, Items{b, a}, "a", nil, nil},
+		{"oldest revision equal dates", AmbiguityPolicyOldestRevision, Items{b, c}, "", []string{"b", "c"}, ErrItemNotUnique},
+		{"prefer organization", AmbiguityPolicyPreferOrganization, Items{a, b}, "b", nil, nil},
+		{"prefer organization several", AmbiguityPolicyPreferOrganization, Items{a, b, d}, "", []string{"b", "d"}, ErrItemNotUnique},
+		{"prefer organization none", AmbiguityPolicyPreferOrganization, Items{a, c}, "", []string{"a", "c"}, ErrItemNotUnique},
+		{"prefer personal", AmbiguityPolicyPreferPersonal, Items{b, c}, "c", nil, nil},
+		{"prefer personal several", AmbiguityPolicyPreferPersonal, Items{a, b, c}, "", []string{"a", "c"}, ErrItemNotUnique},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := c.policy.Resolve(c.candidates)
+			if !errors.Is(err, c.err) {
+				t.Fatalf("expected error %v but got %v", c.err, err)
+			}
+			if c.err != nil {
+				var nue *ItemNotUniqueError
+				if errors.As(err, &nue) && !reflect.DeepEqual(nue.Ids(), c.ambiguous) {
+					t.Errorf("expected candidates %v but got %v", c.ambiguous, nue.Ids())
+				}
+				return
+			}
+			if actual.Id != c.expected {
+				t.Errorf("expected %s but got %s", c.expected, actual.Id)
+			}
+		})
+	}
+}
+
+func TestAmbiguityPolicy_Validate(t *testing.T) {
+	for _, policy := range append([]AmbiguityPolicy{""}, AllAmbiguityPolicies...) {
+		if err := policy.Validate(); err != nil {
+			t.Errorf("%q: unexpected error %v", policy, err)
+		}
+	}
+	if err := AmbiguityPolicy("first").Validate(); !errors.Is(err, ErrIllegalAmbiguityPolicy) {
+		t.Errorf("expected illegal ambiguity policy but got %v", err)
+	}
+}
+
+func TestResolveAttachment(t *testing.T) {
+	a := ItemAttachmentReference{Id: "a", FileName: "state.json"}
+	b := ItemAttachmentReference{Id: "b", FileName: "state.json"}
+
+	cases := []struct {
+		name       string
+		candidates ItemAttachmentReferences
+		expected   string
+		ambiguous  []string
+		err        error
+	}{
+		{"none", nil, "", nil, ErrNoSuchAttachment},
+		{"unique", ItemAttachmentReferences{a}, "a", nil, nil},
+		{"ambiguous", ItemAttachmentReferences{a, b}, "", []string{"a", "b"}, ErrAttachmentNotUnique},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := ResolveAttachment(c.candidates)
+			if !errors.Is(err, c.err) {
+				t.Fatalf("expected error %v but got %v", c.err, err)
+			}
+			if c.err != nil {
+				var anue *AttachmentNotUniqueError
+				if errors.As(err, &anue) && !reflect.DeepEqual(anue.Ids(), c.ambiguous) {
+					t.Errorf("expected candidates %v but got %v", c.ambiguous, anue.Ids())
+				}
+				return
+			}
+			if actual.Id != c.expected {
+				t.Errorf("expected %s but got %s", c.expected, actual.Id)
+			}
+		})
+	}
+}
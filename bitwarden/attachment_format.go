@@ -0,0 +1,254 @@
+package bitwarden
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+type AttachmentFormat string
+
+const (
+	AttachmentFormatRaw    = AttachmentFormat("raw")
+	AttachmentFormatBase64 = AttachmentFormat("base64")
+	AttachmentFormatJson   = AttachmentFormat("json")
+	AttachmentFormatYaml   = AttachmentFormat("yaml")
+	AttachmentFormatDotenv = AttachmentFormat("dotenv")
+	AttachmentFormatPem    = AttachmentFormat("pem")
+)
+
+var (
+	ErrIllegalAttachmentFormat = errors.New("illegal attachment format")
+
+	AllAttachmentFormats = []AttachmentFormat{
+		AttachmentFormatRaw,
+		AttachmentFormatBase64,
+		AttachmentFormatJson,
+		AttachmentFormatYaml,
+		AttachmentFormatDotenv,
+		AttachmentFormatPem,
+	}
+)
+
+func (this AttachmentFormat) Validate() error {
+	if this == "" {
+		return nil
+	}
+	for _, candidate := range AllAttachmentFormats {
+		if this == candidate {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrIllegalAttachmentFormat, string(this))
+}
+
+func (this AttachmentFormat) IsStructured() bool {
+	switch this {
+	case AttachmentFormatJson, AttachmentFormatYaml, AttachmentFormatDotenv, AttachmentFormatPem:
+		return true
+	default:
+		return false
+	}
+}
+
+// Decode decodes the given content and returns it in its representation for
+// attachments_decoded. Structured formats are always returned as JSON
+// document, which could be consumed using jsondecode(). They cannot be
+// returned as typed values, because the plugin SDK (v2) neither supports
+// dynamic types nor maps of non-primitive values.
+func (this AttachmentFormat) Decode(content Attachment) (string, error) {
+	switch this {
+	case "", AttachmentFormatRaw:
+		return string(content), nil
+	case AttachmentFormatBase64:
+		return base64.StdEncoding.EncodeToString(content), nil
+	case AttachmentFormatJson:
+		return this.decodeJson(content)
+	case AttachmentFormatYaml:
+		return this.decodeYaml(content)
+	case AttachmentFormatDotenv:
+		return this.decodeDotenv(content)
+	case AttachmentFormatPem:
+		return this.decodePem(content)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrIllegalAttachmentFormat, string(this))
+	}
+}
+
+func (this AttachmentFormat) decodeJson(content Attachment) (string, error) {
+	var buf interface{}
+	if err := json.Unmarshal(content, &buf); err != nil {
+		return "", err
+	}
+	return this.encodeJson(buf)
+}
+
+func (this AttachmentFormat) decodeYaml(content Attachment) (string, error) {
+	var buf interface{}
+	if err := yaml.Unmarshal(content, &buf); err != nil {
+		return "", err
+	}
+	normalized, err := normalizeYamlValue(buf)
+	if err != nil {
+		return "", err
+	}
+	return this.encodeJson(normalized)
+}
+
+func normalizeYamlValue(in interface{}) (interface{}, error) {
+	switch v := in.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			ne, err := normalizeYamlValue(e)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = ne
+		}
+		return result, nil
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			ne, err := normalizeYamlValue(e)
+			if err != nil {
+				return nil, err
+			}
+			result[fmt.Sprint(k)] = ne
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, e := range v {
+			ne, err := normalizeYamlValue(e)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = ne
+		}
+		return result, nil
+	default:
+		return v, nil
+	}
+}
+
+func (this AttachmentFormat) decodeDotenv(content Attachment) (string, error) {
+	result := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	line := 0
+	for scanner.Scan() {
+		line++
+		plain := strings.TrimSpace(scanner.Text())
+		if plain == "" || strings.HasPrefix(plain, "#") {
+			continue
+		}
+		plain = strings.TrimSpace(strings.TrimPrefix(plain, "export "))
+		parts := strings.SplitN(plain, "=", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("line %d: expected KEY=VALUE", line)
+		}
+		key := strings.TrimSpace(parts[0])
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return "", fmt.Errorf("line %d: illegal key '%s'", line, key)
+		}
+		value, err := decodeDotenvValue(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return "", fmt.Errorf("line %d: %w", line, err)
+		}
+		result[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return this.encodeJson(result)
+}
+
+func decodeDotenvValue(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	switch plain[0] {
+	case '\'':
+		end := strings.IndexByte(plain[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quoted value")
+		}
+		return plain[1 : end+1], nil
+	case '"':
+		var buf strings.Builder
+		for i := 1; i < len(plain); i++ {
+			c := plain[i]
+			switch {
+			case c == '"':
+				return buf.String(), nil
+			case c == '\\' && i+1 < len(plain):
+				i++
+				switch plain[i] {
+				case 'n':
+					buf.WriteByte('\n')
+				case 'r':
+					buf.WriteByte('\r')
+				case 't':
+					buf.WriteByte('\t')
+				default:
+					buf.WriteByte(plain[i])
+				}
+			default:
+				buf.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated double quoted value")
+	default:
+		if i := strings.Index(plain, " #"); i >= 0 {
+			plain = plain[:i]
+		}
+		return strings.TrimSpace(plain), nil
+	}
+}
+
+func (this AttachmentFormat) decodePem(content Attachment) (string, error) {
+	type block struct {
+		Type    string            `json:"type"`
+		Headers map[string]string `json:"headers"`
+		Bytes   string            `json:"bytes"`
+	}
+	var result []block
+	rest := []byte(content)
+	for {
+		var b *pem.Block
+		b, rest = pem.Decode(rest)
+		if b == nil {
+			break
+		}
+		headers := b.Headers
+		if headers == nil {
+			headers = map[string]string{}
+		}
+		result = append(result, block{
+			Type:    b.Type,
+			Headers: headers,
+			Bytes:   base64.StdEncoding.EncodeToString(b.Bytes),
+		})
+	}
+	if len(result) == 0 {
+		return "", fmt.Errorf("no PEM block found")
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return "", fmt.Errorf("unexpected trailing content after last PEM block")
+	}
+	return this.encodeJson(result)
+}
+
+func (this AttachmentFormat) encodeJson(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,87 @@
+package bitwarden
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAttachmentFormat_Decode(t *testing.T) {
+	pemBlock := func(typ string, content string) string {
+		return fmt.Sprintf("-----BEGIN %s-----\n%s\n-----END %s-----\n", typ, base64.StdEncoding.EncodeToString([]byte(content)), typ)
+	}
+	encodedPem := func(typ string, content string) string {
+		return fmt.Sprintf(`{"type":%q,"headers":{},"bytes":%q}`, typ, base64.StdEncoding.EncodeToString([]byte(content)))
+	}
+
+	cases := []struct {
+		name     string
+		format   AttachmentFormat
+		content  string
+		expected string
+		err      string
+	}{
+		{"raw", AttachmentFormatRaw, "a\nb", "a\nb", ""},
+		{"default", "", "a", "a", ""},
+		{"base64", AttachmentFormatBase64, "foo", "Zm9v", ""},
+		{"json", AttachmentFormatJson, `{ "b": 1, "a": [true] }`, `{"a":[true],"b":1}`, ""},
+		{"json invalid", AttachmentFormatJson, `{"a":`, "", "unexpected end of JSON input"},
+
+		{"dotenv", AttachmentFormatDotenv, "A=1\nexport B = 2\n", `{"A":"1","B":"2"}`, ""},
+		{"dotenv comments", AttachmentFormatDotenv, "# comment\n\n  # indented\nA=1 # trailing\nB=a#b\n", `{"A":"1","B":"a#b"}`, ""},
+		{"dotenv single quoted", AttachmentFormatDotenv, `A='a "b" \n # c' # trailing`, `{"A":"a \"b\" \\n # c"}`, ""},
+		{"dotenv double quoted", AttachmentFormatDotenv, `A="a\n\t\"b\" # c" # trailing`, `{"A":"a\n\t\"b\" # c"}`, ""},
+		{"dotenv empty value", AttachmentFormatDotenv, "A=\nB=''", `{"A":"","B":""}`, ""},
+		{"dotenv value with equals", AttachmentFormatDotenv, "A=b=c", `{"A":"b=c"}`, ""},
+		{"dotenv unterminated single quote", AttachmentFormatDotenv, "A=1\nB='a", "", "line 2: unterminated single quoted value"},
+		{"dotenv unterminated double quote", AttachmentFormatDotenv, `A="a\"`, "", "line 1: unterminated double quoted value"},
+		{"dotenv missing equals", AttachmentFormatDotenv, "A", "", "line 1: expected KEY=VALUE"},
+		{"dotenv illegal key", AttachmentFormatDotenv, "A B=1", "", "line 1: illegal key 'A B'"},
+		{"dotenv empty key", AttachmentFormatDotenv, "=1", "", "line 1: illegal key ''"},
+
+		{"yaml", AttachmentFormatYaml, "b: 1\na: foo\n", `{"a":"foo","b":1}`, ""},
+		{"yaml nested", AttachmentFormatYaml, "a:\n  b:\n    - c: true\n    - 2\n  1: x\n", `{"a":{"1":"x","b":[{"c":true},2]}}`, ""},
+		{"yaml list", AttachmentFormatYaml, "- a\n- b\n", `["a","b"]`, ""},
+		{"yaml invalid", AttachmentFormatYaml, "a: [b\n", "", "yaml:"},
+		{"yaml tab indentation", AttachmentFormatYaml, "a:\n\tb: c\n", "", "yaml:"},
+
+		{"pem", AttachmentFormatPem, pemBlock("CERTIFICATE", "foo"), "[" + encodedPem("CERTIFICATE", "foo") + "]", ""},
+		{"pem several blocks", AttachmentFormatPem, pemBlock("CERTIFICATE", "foo") + "\n" + pemBlock("PRIVATE KEY", "bar"), "[" + encodedPem("CERTIFICATE", "foo") + "," + encodedPem("PRIVATE KEY", "bar") + "]", ""},
+		{"pem headers", AttachmentFormatPem, "-----BEGIN FOO-----\nA: b\n\nZm9v\n-----END FOO-----\n", `[{"type":"FOO","headers":{"A":"b"},"bytes":"Zm9v"}]`, ""},
+		{"pem none", AttachmentFormatPem, "foo\nbar\n", "", "no PEM block found"},
+		{"pem empty", AttachmentFormatPem, "", "", "no PEM block found"},
+		{"pem trailing content", AttachmentFormatPem, pemBlock("CERTIFICATE", "foo") + "foo\n", "", "unexpected trailing content after last PEM block"},
+
+		{"illegal", AttachmentFormat("foo"), "a", "", "illegal attachment format: foo"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := c.format.Decode(Attachment(c.content))
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected error containing %q but got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual != c.expected {
+				t.Errorf("expected %s but got %s", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestAttachmentFormat_Validate(t *testing.T) {
+	for _, format := range append([]AttachmentFormat{""}, AllAttachmentFormats...) {
+		if err := format.Validate(); err != nil {
+			t.Errorf("%q: unexpected error %v", format, err)
+		}
+	}
+	if err := AttachmentFormat("xml").Validate(); !errors.Is(err, ErrIllegalAttachmentFormat) {
+		t.Errorf("expected illegal attachment format but got %v", err)
+	}
+}
@@ -22,6 +22,10 @@ var (
 	ErrWrongSession  = errors.New("BW_SESSION either wrong or expired")
 	ErrNoSuchItem    = errors.New("no such item")
 	ErrItemNotUnique = errors.New("item not unique")
+	ErrItemOutOfDate = errors.New("item was modified since last sync")
+
+	ErrNoSuchAttachment    = errors.New("no such attachment")
+	ErrAttachmentNotUnique = errors.New("attachment not unique")
 
 	DetailWrongSession = "BW_SESSION does contain a wrong or expired session token. Try either `bw unlock` (if already logged it) or `bw login` to acquire a new session token and set the content to BW_SESSION environment variable."
 )
@@ -204,6 +208,8 @@ func (this *Bitwarden) FindItems(q ItemsQuery) (Items, error) {
 		return nil, err
 	}
 
+	items = q.ItemFilter.Filter(items)
+
 	for i, item := range items {
 		if err := item.ResolveAttachments(q.Attachments, this); err != nil {
 			return nil, err
@@ -222,8 +228,8 @@ func (this *Bitwarden) FindItem(q ItemQuery) (*Item, error) {
 	if v := q.Name; v != "" {
 		args = append(args, "--search", v)
 		atLeastOneLimitationProvided = true
-	} else {
-		return nil, fmt.Errorf("no name in item query provided")
+	} else if q.ItemFilter.IsEmpty() {
+		return nil, fmt.Errorf("neither name nor any other criteria in item query provided")
 	}
 
 	if v := q.OrganizationId; v != "" {
@@ -251,19 +257,16 @@ func (this *Bitwarden) FindItem(q ItemQuery) (*Item, error) {
 		return nil, err
 	}
 
-	var match *Item
+	var candidates Items
 	for _, item := range items {
-		if item.Name == q.Name {
-			if match != nil {
-				return nil, ErrItemNotUnique
-			}
-			v := item
-			match = &v
+		if q.matchesName(item) && q.ItemFilter.Matches(item) {
+			candidates = append(candidates, item)
 		}
 	}
 
-	if match == nil {
-		return nil, ErrNoSuchItem
+	match, err := q.OnAmbiguity.Resolve(candidates)
+	if err != nil {
+		return nil, err
 	}
 
 	if err := match.ResolveAttachments(q.Attachments, this); err != nil {
@@ -287,32 +290,99 @@ func (this *Bitwarden) GetItem(id string, aq ItemAttachmentQueries) (*Item, erro
 	return &item, nil
 }
 
-func (this *Bitwarden) CreateAttachment(of Item, attachmentName string, attachment Attachment) (gErr error) {
+func (this *Bitwarden) CreateItem(item Item) (*Item, error) {
+	encoded, err := json.Marshal(item.toCreateRequest())
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode item %s: %w", item.Name, err)
+	}
+
+	var result Item
+	if err := this.ExecuteAndUnmarshal(nil, &result, "create", "item", base64.StdEncoding.EncodeToString(encoded)); err != nil {
+		return nil, fmt.Errorf("cannot create item %s: %w", item.Name, err)
+	}
+	log.With("itemName", result.Name).
+		With("itemId", result.Id).
+		Debug("Item created.")
+
+	return &result, nil
+}
+
+// EditItem applies the given patch to the current raw representation of the
+// item inside Bitwarden. This ensures that no properties get lost which are
+// not part of Item.
+func (this *Bitwarden) EditItem(item Item, patch map[string]interface{}) (*Item, error) {
+	raw, err := this.Execute(nil, "get", "item", item.Id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot edit item %s (%s): %w", item.Name, item.Id, err)
+	}
+	current := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &current); err != nil {
+		return nil, fmt.Errorf("cannot edit item %s (%s): %w", item.Name, item.Id, err)
+	}
+	for k, v := range patch {
+		current[k] = v
+	}
+	encoded, err := json.Marshal(current)
+	if err != nil {
+		return nil, fmt.Errorf("cannot edit item %s (%s): %w", item.Name, item.Id, err)
+	}
+
+	var result Item
+	if err := this.ExecuteAndUnmarshal(nil, &result, "edit", "item", item.Id, base64.StdEncoding.EncodeToString(encoded)); err != nil {
+		// Bitwarden rejects edits based on an outdated revision of the item
+		// (compared to the last sync) with this message.
+		if strings.Contains(err.Error(), "is out of date") {
+			return nil, fmt.Errorf("cannot edit item %s (%s): %w: %v", item.Name, item.Id, ErrItemOutOfDate, err)
+		}
+		return nil, fmt.Errorf("cannot edit item %s (%s): %w", item.Name, item.Id, err)
+	}
+	log.With("itemName", result.Name).
+		With("itemId", result.Id).
+		Debug("Item edited.")
+
+	return &result, nil
+}
+
+func (this *Bitwarden) DeleteItem(item Item) error {
+	if _, err := this.Execute(nil, "delete", "item", item.Id); err != nil {
+		return fmt.Errorf("cannot delete item %s (%s): %w", item.Name, item.Id, err)
+	}
+	log.With("itemName", item.Name).
+		With("itemId", item.Id).
+		Debug("Item deleted.")
+
+	return nil
+}
+
+// CreateAttachment uploads the given attachment and returns the item as it is
+// stored in Bitwarden afterwards, including all of its attachments.
+func (this *Bitwarden) CreateAttachment(of Item, attachmentName string, attachment Attachment) (result *Item, gErr error) {
 	defer func() {
 		if gErr != nil {
 			gErr = fmt.Errorf("cannot create attachment '%s' for item %s (%s): %w", attachmentName, of.Name, of.Id, gErr)
 		}
 	}()
 
+	var updated Item
 	if this.legacyAttachment {
 		file, err := attachment.ToTempFile(attachmentName)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		defer func() {
 			if err := file.Close(); err != nil && gErr == nil {
 				gErr = err
 			}
 		}()
-		if _, err := this.Execute(nil, "create", "attachment", "--itemid", of.Id, "--file", file.Name); err != nil {
-			return err
+		if err := this.ExecuteAndUnmarshal(nil, &updated, "create", "attachment", "--itemid", of.Id, "--file", file.Name); err != nil {
+			return nil, err
 		}
 
 	} else {
-		if _, err := this.Execute(func(cmd *exec.Cmd) {
+		if err := this.ExecuteAndUnmarshal(func(cmd *exec.Cmd) {
 			cmd.Stdin = attachment.ToReader()
-		}, "create", "attachment", "--itemid", of.Id, "--file", attachmentName, "--stdin"); err != nil {
-			return err
+		}, &updated, "create", "attachment", "--itemid", of.Id, "--file", attachmentName, "--stdin"); err != nil {
+			return nil, err
 		}
 	}
 	log.With("itemName", of.Name).
@@ -320,7 +390,7 @@ func (this *Bitwarden) CreateAttachment(of Item, attachmentName string, attachme
 		With("attachmentName", attachmentName).
 		Debug("Attachment created.")
 
-	return nil
+	return &updated, nil
 }
 
 func (this *Bitwarden) DeleteAttachment(of Item, attachment ItemAttachmentReference) (gErr error) {
@@ -343,29 +413,49 @@ func (this *Bitwarden) DeleteAttachment(of Item, attachment ItemAttachmentRefere
 	return nil
 }
 
-func (this *Bitwarden) GetAttachments(of Item, by ItemAttachmentQueries) (ItemAttachments, error) {
-	result := ItemAttachments{}
+func (this *Bitwarden) GetAttachments(of Item, by ItemAttachmentQueries) (resolved ItemAttachments, decoded ItemAttachments, err error) {
+	resolved, decoded = ItemAttachments{}, ItemAttachments{}
 	for _, ref := range of.AttachmentReferences {
 		for _, q := range by {
 			if q.FilenameMatches.MatchString(ref.FileName) {
-				v, err := this.GetAttachment(of, ref.Id, q.Base64Encode)
+				size, err := ref.SizeInBytes()
 				if err != nil {
-					return nil, err
+					return nil, nil, err
+				}
+				if err := q.CheckSize(of, ref, size); err != nil {
+					return nil, nil, err
 				}
-				if _, alreadyExists := result[q.Name]; alreadyExists && q.Unique {
-					return nil, fmt.Errorf("%v: more then one attachment matching %v but it should be unique", q.Name, q.FilenameMatches)
+				content, err := this.GetAttachmentContent(of, ref.Id)
+				if err != nil {
+					return nil, nil, err
 				}
-				result[q.Name] = v
+				if err := q.CheckSize(of, ref, int64(len(content))); err != nil {
+					return nil, nil, err
+				}
+				if _, alreadyExists := resolved[q.Name]; alreadyExists && q.Unique {
+					return nil, nil, fmt.Errorf("%v: more then one attachment matching %v but it should be unique", q.Name, q.FilenameMatches)
+				}
+				format := q.GetFormat()
+				dv, err := format.Decode(content)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%v: cannot decode attachment '%s' (%s) of item %v (%v) as %v: %w", q.Name, ref.FileName, ref.Id, of.Name, of.Id, format, err)
+				}
+				if format == AttachmentFormatBase64 {
+					resolved[q.Name] = dv
+				} else {
+					resolved[q.Name] = string(content)
+				}
+				decoded[q.Name] = dv
 			}
 		}
 	}
-	return result, nil
+	return resolved, decoded, nil
 }
 
 func (this *Bitwarden) GetAttachment(of Item, attachmentId string, base64encoded bool) (string, error) {
-	v, err := this.Execute(nil, "get", "attachment", attachmentId, "--itemid", of.Id, "--raw")
+	v, err := this.GetAttachmentContent(of, attachmentId)
 	if err != nil {
-		return "", fmt.Errorf("cannot get attachment %s of item %v (%v)", attachmentId, of.Name, of.Id)
+		return "", err
 	}
 	if base64encoded {
 		return base64.StdEncoding.EncodeToString(v), nil
@@ -373,6 +463,14 @@ func (this *Bitwarden) GetAttachment(of Item, attachmentId string, base64encoded
 	return string(v), nil
 }
 
+func (this *Bitwarden) GetAttachmentContent(of Item, attachmentId string) (Attachment, error) {
+	v, err := this.Execute(nil, "get", "attachment", attachmentId, "--itemid", of.Id, "--raw")
+	if err != nil {
+		return nil, fmt.Errorf("cannot get attachment %s of item %v (%v): %w", attachmentId, of.Name, of.Id, err)
+	}
+	return v, nil
+}
+
 type CommandCustomizer func(*exec.Cmd)
 
 func (this *Bitwarden) ExecuteAndUnmarshal(customizer CommandCustomizer, to interface{}, args ...string) error {
@@ -406,7 +504,6 @@ func (this *Bitwarden) ExecuteDirect(customizer CommandCustomizer, args ...strin
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 	cmd := exec.Command(this.executable[0], append(this.executable[1:], args...)...)
-	cmd.Dir = "C:\\development\\github.com\\blaubaer\\cli"
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	cmd.Env = utils.AddEnvironment(os.Environ(), map[string]string{
@@ -0,0 +1,171 @@
+package bitwarden
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+)
+
+type ItemFilter struct {
+	Uri       string
+	Fields    ItemFieldQueries
+	Type      int
+	Favorite  *bool
+	NameRegex *regexp.Regexp
+}
+
+func (this ItemFilter) IsEmpty() bool {
+	return this.Uri == "" &&
+		len(this.Fields) == 0 &&
+		this.Type == 0 &&
+		this.Favorite == nil &&
+		this.NameRegex == nil
+}
+
+func (this ItemFilter) Matches(item Item) bool {
+	if v := this.Uri; v != "" && !item.Login.Uris.Matches(v) {
+		return false
+	}
+	if !this.Fields.Matches(item.Fields) {
+		return false
+	}
+	if v := this.Type; v != 0 && item.Type != v {
+		return false
+	}
+	if v := this.Favorite; v != nil && item.Favorite != *v {
+		return false
+	}
+	if v := this.NameRegex; v != nil && !v.MatchString(item.Name) {
+		return false
+	}
+	return true
+}
+
+func (this ItemFilter) Filter(items Items) Items {
+	if this.IsEmpty() {
+		return items
+	}
+	var result Items
+	for _, item := range items {
+		if this.Matches(item) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+type ItemFieldQuery struct {
+	Name  string
+	Value string
+}
+
+func (this ItemFieldQuery) Matches(fields ItemFields) bool {
+	for _, field := range fields {
+		if field.Name == this.Name && (this.Value == "" || field.Value == this.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *ItemFieldQuery) Parse(plain interface{}) error {
+	switch v := plain.(type) {
+	case nil:
+		return this.parse(nil)
+	case map[string]interface{}:
+		return this.parse(v)
+	case *map[string]interface{}:
+		return this.parse(*v)
+	default:
+		return fmt.Errorf("cannot parse (%v) %+v as item field query", reflect.TypeOf(plain), plain)
+	}
+}
+
+func (this *ItemFieldQuery) parse(plain map[string]interface{}) error {
+	if plain == nil {
+		*this = ItemFieldQuery{}
+		return nil
+	}
+	for k, v := range plain {
+		var parser func(plain interface{}) error
+		switch k {
+		case "name":
+			parser = this.parseName
+		case "value":
+			parser = this.parseValue
+		}
+		if parser != nil {
+			if err := parser(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (this *ItemFieldQuery) parseName(plain interface{}) error {
+	if plain == nil {
+		return fmt.Errorf("empty field.name provided")
+	}
+	if v, ok := plain.(string); ok {
+		if v == "" {
+			return fmt.Errorf("empty field.name provided")
+		}
+		this.Name = v
+		return nil
+	}
+	return fmt.Errorf("illegal field.name provided: %+v", plain)
+}
+
+func (this *ItemFieldQuery) parseValue(plain interface{}) error {
+	if plain == nil {
+		this.Value = ""
+		return nil
+	}
+	if v, ok := plain.(string); ok {
+		this.Value = v
+		return nil
+	}
+	return fmt.Errorf("illegal field.value provided: %+v", plain)
+}
+
+type ItemFieldQueries []ItemFieldQuery
+
+func (this ItemFieldQueries) Matches(fields ItemFields) bool {
+	for _, q := range this {
+		if !q.Matches(fields) {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *ItemFieldQueries) Parse(plain interface{}) error {
+	switch v := plain.(type) {
+	case nil:
+		return this.parse(nil)
+	case []interface{}:
+		return this.parse(v)
+	case *[]interface{}:
+		return this.parse(*v)
+	default:
+		return fmt.Errorf("cannot parse (%v) %+v as item field queries", reflect.TypeOf(plain), plain)
+	}
+}
+
+func (this *ItemFieldQueries) parse(plain []interface{}) error {
+	if plain == nil {
+		*this = ItemFieldQueries{}
+		return nil
+	}
+	buf := make(ItemFieldQueries, len(plain))
+	for i, v := range plain {
+		var nv ItemFieldQuery
+		if err := nv.Parse(v); err != nil {
+			return err
+		}
+		buf[i] = nv
+	}
+	*this = buf
+	return nil
+}
@@ -0,0 +1,116 @@
+package bitwarden
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestItemFilter_Matches(t *testing.T) {
+	yes, no := true, false
+	exact := UriMatchExact
+	item := Item{
+		Name:     "Database production",
+		Type:     ItemTypeLogin,
+		Favorite: true,
+		Fields: ItemFields{
+			{Name: "environment", Value: "production"},
+			{Name: "team", Value: "platform"},
+		},
+		Login: ItemLogin{Uris: ItemLoginUris{
+			{Uri: "https://db.example.com"},
+			{Match: &exact, Uri: "https://console.example.org/db"},
+		}},
+	}
+
+	cases := []struct {
+		name     string
+		filter   ItemFilter
+		expected bool
+	}{
+		{"empty", ItemFilter{}, true},
+		{"uri domain", ItemFilter{Uri: "https://admin.example.com"}, true},
+		{"uri exact", ItemFilter{Uri: "https://console.example.org/db"}, true},
+		{"uri exact other path", ItemFilter{Uri: "https://console.example.org/other"}, false},
+		{"uri other", ItemFilter{Uri: "https://example.net"}, false},
+		{"field name", ItemFilter{Fields: ItemFieldQueries{{Name: "team"}}}, true},
+		{"field name and value", ItemFilter{Fields: ItemFieldQueries{{Name: "environment", Value: "production"}}}, true},
+		{"field wrong value", ItemFilter{Fields: ItemFieldQueries{{Name: "environment", Value: "staging"}}}, false},
+		{"field missing", ItemFilter{Fields: ItemFieldQueries{{Name: "owner"}}}, false},
+		{"fields all required", ItemFilter{Fields: ItemFieldQueries{{Name: "team"}, {Name: "owner"}}}, false},
+		{"type", ItemFilter{Type: ItemTypeLogin}, true},
+		{"type other", ItemFilter{Type: ItemTypeSecureNote}, false},
+		{"favorite", ItemFilter{Favorite: &yes}, true},
+		{"not favorite", ItemFilter{Favorite: &no}, false},
+		{"name regex", ItemFilter{NameRegex: regexp.MustCompile(`^Database `)}, true},
+		{"name regex case insensitive", ItemFilter{NameRegex: regexp.MustCompile(`(?i)^database PRODUCTION$`)}, true},
+		{"name regex other", ItemFilter{NameRegex: regexp.MustCompile(`staging`)}, false},
+		{"combined", ItemFilter{Uri: "db.example.com", Type: ItemTypeLogin, Favorite: &yes, Fields: ItemFieldQueries{{Name: "team", Value: "platform"}}}, true},
+		{"combined one mismatch", ItemFilter{Uri: "db.example.com", Type: ItemTypeLogin, Favorite: &no}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := c.filter.Matches(item); actual != c.expected {
+				t.Errorf("Matches() = %v; expected %v", actual, c.expected)
+			}
+		})
+	}
+}
+
+func TestItemFilter_Filter(t *testing.T) {
+	items := Items{
+		{Id: "1", Name: "a", Type: ItemTypeLogin},
+		{Id: "2", Name: "b", Type: ItemTypeSecureNote},
+		{Id: "3", Name: "c", Type: ItemTypeLogin},
+	}
+
+	if actual := (ItemFilter{}).Filter(items); len(actual) != 3 {
+		t.Errorf("empty filter should return all items but got %d", len(actual))
+	}
+
+	actual := ItemFilter{Type: ItemTypeLogin}.Filter(items)
+	if len(actual) != 2 || actual[0].Id != "1" || actual[1].Id != "3" {
+		t.Errorf("expected items 1 and 3 but got %+v", actual)
+	}
+
+	if actual := (ItemFilter{Type: ItemTypeCard}).Filter(items); len(actual) != 0 {
+		t.Errorf("expected no items but got %+v", actual)
+	}
+}
+
+func TestItemQuery_matchesName(t *testing.T) {
+	cases := []struct {
+		name     string
+		query    ItemQuery
+		expected bool
+	}{
+		{"no name", ItemQuery{}, true},
+		{"exact", ItemQuery{Name: "My Item"}, true},
+		{"other case", ItemQuery{Name: "my item"}, false},
+		{"other case ignored", ItemQuery{Name: "my item", IgnoreCase: true}, true},
+		{"other", ItemQuery{Name: "My Item 2", IgnoreCase: true}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := c.query.matchesName(Item{Name: "My Item"}); actual != c.expected {
+				t.Errorf("matchesName() = %v; expected %v", actual, c.expected)
+			}
+		})
+	}
+}
+
+func TestItemFieldQueries_Parse(t *testing.T) {
+	var actual ItemFieldQueries
+	if err := actual.Parse([]interface{}{
+		map[string]interface{}{"name": "environment", "value": "production"},
+		map[string]interface{}{"name": "team"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 2 || actual[0] != (ItemFieldQuery{"environment", "production"}) || actual[1] != (ItemFieldQuery{"team", ""}) {
+		t.Errorf("unexpected result: %+v", actual)
+	}
+
+	if err := actual.Parse([]interface{}{map[string]interface{}{"name": ""}}); err == nil {
+		t.Errorf("expected error for empty field.name")
+	}
+}
@@ -0,0 +1,94 @@
+package bitwarden
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/echocat/slf4g"
+)
+
+var (
+	ErrNoSuchFolder     = errors.New("no such folder")
+	ErrNoSuchCollection = errors.New("no such collection")
+)
+
+type Folder struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Collection struct {
+	Id             string `json:"id"`
+	OrganizationId string `json:"organizationId"`
+	Name           string `json:"name"`
+}
+
+// FindFolder returns the folder with exactly the given name.
+func (this *Bitwarden) FindFolder(name string) (*Folder, error) {
+	var candidates []Folder
+	if err := this.ExecuteAndUnmarshal(nil, &candidates, "list", "folders", "--search", name, "--raw"); err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		if candidate.Name == name && candidate.Id != "" {
+			return &candidate, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoSuchFolder, name)
+}
+
+func (this *Bitwarden) CreateFolder(name string) (*Folder, error) {
+	encoded, err := json.Marshal(map[string]interface{}{"name": name})
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode folder %s: %w", name, err)
+	}
+
+	var result Folder
+	if err := this.ExecuteAndUnmarshal(nil, &result, "create", "folder", base64.StdEncoding.EncodeToString(encoded)); err != nil {
+		return nil, fmt.Errorf("cannot create folder %s: %w", name, err)
+	}
+	log.With("folderName", result.Name).
+		With("folderId", result.Id).
+		Debug("Folder created.")
+
+	return &result, nil
+}
+
+// FindCollection returns the collection of the given organization with
+// exactly the given name.
+func (this *Bitwarden) FindCollection(organizationId, name string) (*Collection, error) {
+	var candidates []Collection
+	if err := this.ExecuteAndUnmarshal(nil, &candidates, "list", "org-collections", "--organizationid", organizationId, "--search", name, "--raw"); err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		if candidate.Name == name {
+			return &candidate, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoSuchCollection, name)
+}
+
+func (this *Bitwarden) CreateCollection(organizationId, name string) (*Collection, error) {
+	encoded, err := json.Marshal(map[string]interface{}{
+		"organizationId": organizationId,
+		"name":           name,
+		"externalId":     nil,
+		"groups":         []interface{}{},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode collection %s: %w", name, err)
+	}
+
+	var result Collection
+	if err := this.ExecuteAndUnmarshal(nil, &result, "create", "org-collection", "--organizationid", organizationId, base64.StdEncoding.EncodeToString(encoded)); err != nil {
+		return nil, fmt.Errorf("cannot create collection %s: %w", name, err)
+	}
+	log.With("collectionName", result.Name).
+		With("collectionId", result.Id).
+		With("organizationId", result.OrganizationId).
+		Debug("Collection created.")
+
+	return &result, nil
+}
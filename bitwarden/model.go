@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,21 +17,72 @@ type Item struct {
 	Type                 int                      `json:"type"`
 	Reprompt             int                      `json:"reprompt"`
 	Name                 string                   `json:"name"`
+	Notes                string                   `json:"notes"`
 	Favorite             bool                     `json:"favorite"`
 	Fields               ItemFields               `json:"fields"`
 	Login                ItemLogin                `json:"login"`
 	CollectionIds        []string                 `json:"collectionIds"`
 	AttachmentReferences ItemAttachmentReferences `json:"attachments"`
 	ResolvedAttachments  ItemAttachments          `json:"-"`
+	DecodedAttachments   ItemAttachments          `json:"-"`
 	RevisionDate         *time.Time               `json:"revisionDate"`
 }
 
+const (
+	ItemTypeLogin      = 1
+	ItemTypeSecureNote = 2
+	ItemTypeCard       = 3
+	ItemTypeIdentity   = 4
+)
+
+type itemCreateRequest struct {
+	OrganizationId *string         `json:"organizationId"`
+	CollectionIds  []string        `json:"collectionIds,omitempty"`
+	FolderId       *string         `json:"folderId"`
+	Type           int             `json:"type"`
+	Name           string          `json:"name"`
+	Notes          string          `json:"notes"`
+	Favorite       bool            `json:"favorite"`
+	Fields         ItemFields      `json:"fields,omitempty"`
+	Login          *ItemLogin      `json:"login,omitempty"`
+	SecureNote     *itemSecureNote `json:"secureNote,omitempty"`
+	Reprompt       int             `json:"reprompt"`
+}
+
+type itemSecureNote struct {
+	Type int `json:"type"`
+}
+
+func (this Item) toCreateRequest() itemCreateRequest {
+	result := itemCreateRequest{
+		OrganizationId: this.OrganizationId,
+		CollectionIds:  this.CollectionIds,
+		FolderId:       this.FolderId,
+		Type:           this.Type,
+		Name:           this.Name,
+		Notes:          this.Notes,
+		Favorite:       this.Favorite,
+		Fields:         this.Fields,
+		Reprompt:       this.Reprompt,
+	}
+	switch this.Type {
+	case ItemTypeLogin:
+		login := this.Login
+		result.Login = &login
+	default:
+		result.Type = ItemTypeSecureNote
+		result.SecureNote = &itemSecureNote{}
+	}
+	return result
+}
+
 func (this *Item) ResolveAttachments(by ItemAttachmentQueries, using *Bitwarden) error {
-	resolved, err := using.GetAttachments(*this, by)
+	resolved, decoded, err := using.GetAttachments(*this, by)
 	if err != nil {
 		return err
 	}
 	this.ResolvedAttachments = resolved
+	this.DecodedAttachments = decoded
 	return nil
 }
 
@@ -41,25 +94,44 @@ func (this Item) ToResponse() map[string]interface{} {
 		"type":            this.Type,
 		"reprompt":        this.Reprompt,
 		"name":            this.Name,
+		"favorite":        this.Favorite,
 		"username":        this.Login.Username,
 		"password":        this.Login.Password,
 		"uris":            this.Login.Uris.ToResponse(),
 		"collection_ids":  this.CollectionIds,
 		"attachments":     this.ResolvedAttachments,
+		"attachment_refs": this.AttachmentReferences.ToResponse(),
+
+		"attachments_decoded": this.DecodedAttachments,
 	}
 }
 
 type ItemQuery struct {
 	Name           string
+	IgnoreCase     bool
 	OrganizationId string
 	CollectionId   string
 	FolderId       string
 
+	ItemFilter
+
+	OnAmbiguity AmbiguityPolicy
+
 	Attachments ItemAttachmentQueries
 
 	OnTooBroadQuery func()
 }
 
+func (this ItemQuery) matchesName(item Item) bool {
+	if this.Name == "" {
+		return true
+	}
+	if this.IgnoreCase {
+		return strings.EqualFold(item.Name, this.Name)
+	}
+	return item.Name == this.Name
+}
+
 type Items []Item
 
 func (this Items) ToResponse() []map[string]interface{} {
@@ -78,6 +150,8 @@ type ItemsQuery struct {
 	CollectionId   string
 	FolderId       string
 
+	ItemFilter
+
 	Attachments ItemAttachmentQueries
 
 	OnTooBroadQuery func()
@@ -91,12 +165,29 @@ type ItemLogin struct {
 }
 
 type ItemLoginUri struct {
-	Match string `json:"match"`
-	Uri   string `json:"uri"`
+	Match *UriMatch `json:"match"`
+	Uri   string    `json:"uri"`
+}
+
+func (this ItemLoginUri) Matches(candidate string) bool {
+	match := UriMatchDomain
+	if v := this.Match; v != nil {
+		match = *v
+	}
+	return match.Matches(this.Uri, candidate)
 }
 
 type ItemLoginUris []ItemLoginUri
 
+func (this ItemLoginUris) Matches(candidate string) bool {
+	for _, uri := range this {
+		if uri.Matches(candidate) {
+			return true
+		}
+	}
+	return false
+}
+
 func (this ItemLoginUris) ToResponse() []string {
 	uris := make([]string, len(this))
 	for i, uri := range this {
@@ -112,15 +203,56 @@ type ItemAttachmentReference struct {
 	Url      string `json:"url"`
 }
 
+func (this ItemAttachmentReference) SizeInBytes() (int64, error) {
+	if this.Size == "" {
+		return 0, nil
+	}
+	result, err := strconv.ParseInt(this.Size, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("illegal size of attachment '%s' (%s): %s", this.FileName, this.Id, this.Size)
+	}
+	return result, nil
+}
+
+func (this ItemAttachmentReference) ToResponse() map[string]interface{} {
+	size, _ := this.SizeInBytes()
+	return map[string]interface{}{
+		"id":        this.Id,
+		"file_name": this.FileName,
+		"size":      int(size),
+		"url":       this.Url,
+	}
+}
+
 type ItemAttachmentReferences []ItemAttachmentReference
 
+func (this ItemAttachmentReferences) ToResponse() []map[string]interface{} {
+	result := make([]map[string]interface{}, len(this))
+	for i, ref := range this {
+		result[i] = ref.ToResponse()
+	}
+	return result
+}
+
 type ItemAttachments map[string]string
 
 type ItemAttachmentQuery struct {
 	Name            string
 	FilenameMatches *regexp.Regexp
 	Base64Encode    bool
+	Format          AttachmentFormat
 	Unique          bool
+	MaxSize         int64
+}
+
+func (this ItemAttachmentQuery) GetFormat() AttachmentFormat {
+	if v := this.Format; v != "" {
+		return v
+	}
+	if this.Base64Encode {
+		return AttachmentFormatBase64
+	}
+	return AttachmentFormatRaw
 }
 
 func (this *ItemAttachmentQuery) Parse(plain interface{}) error {
@@ -150,8 +282,12 @@ func (this *ItemAttachmentQuery) parse(plain map[string]interface{}) error {
 			parser = this.parseFilenameMatches
 		case "base64_encode":
 			parser = this.parseBase64Encode
+		case "format":
+			parser = this.parseFormat
 		case "unique":
 			parser = this.parseUnique
+		case "max_size":
+			parser = this.parseMaxSize
 		}
 		if parser != nil {
 			if err := parser(v); err != nil {
@@ -159,6 +295,9 @@ func (this *ItemAttachmentQuery) parse(plain map[string]interface{}) error {
 			}
 		}
 	}
+	if this.Base64Encode && this.Format != "" && this.Format != AttachmentFormatBase64 {
+		return fmt.Errorf("attachment_query.base64_encode cannot be combined with attachment_query.format %v", this.Format)
+	}
 	return nil
 }
 
@@ -207,6 +346,22 @@ func (this *ItemAttachmentQuery) parseBase64Encode(plain interface{}) error {
 	return fmt.Errorf("illegal attachment_query.base64_encode provided: %+v", plain)
 }
 
+func (this *ItemAttachmentQuery) parseFormat(plain interface{}) error {
+	if plain == nil {
+		this.Format = ""
+		return nil
+	}
+	if v, ok := plain.(string); ok {
+		format := AttachmentFormat(v)
+		if err := format.Validate(); err != nil {
+			return fmt.Errorf("illegal attachment_query.format provided: %w", err)
+		}
+		this.Format = format
+		return nil
+	}
+	return fmt.Errorf("illegal attachment_query.format provided: %+v", plain)
+}
+
 func (this *ItemAttachmentQuery) parseUnique(plain interface{}) error {
 	if plain == nil {
 		this.Unique = false
@@ -219,6 +374,35 @@ func (this *ItemAttachmentQuery) parseUnique(plain interface{}) error {
 	return fmt.Errorf("illegal attachment_query.unique provided: %+v", plain)
 }
 
+func (this *ItemAttachmentQuery) parseMaxSize(plain interface{}) error {
+	if plain == nil {
+		this.MaxSize = 0
+		return nil
+	}
+	var v int64
+	switch pv := plain.(type) {
+	case int:
+		v = int64(pv)
+	case int64:
+		v = pv
+	default:
+		return fmt.Errorf("illegal attachment_query.max_size provided: %+v", plain)
+	}
+	if v < 0 {
+		return fmt.Errorf("illegal attachment_query.max_size provided: %d", v)
+	}
+	this.MaxSize = v
+	return nil
+}
+
+// CheckSize returns an error if the given size exceeds MaxSize of this query.
+func (this ItemAttachmentQuery) CheckSize(of Item, ref ItemAttachmentReference, size int64) error {
+	if this.MaxSize > 0 && size > this.MaxSize {
+		return fmt.Errorf("%v: attachment '%s' (%s) of item %v (%v) has %d bytes which exceeds max_size of %d bytes", this.Name, ref.FileName, ref.Id, of.Name, of.Id, size, this.MaxSize)
+	}
+	return nil
+}
+
 type ItemAttachmentQueries []ItemAttachmentQuery
 
 func (this *ItemAttachmentQueries) Parse(plain interface{}) error {
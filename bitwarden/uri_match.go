@@ -0,0 +1,110 @@
+package bitwarden
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/net/publicsuffix"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type UriMatch uint8
+
+const (
+	UriMatchDomain            = UriMatch(0)
+	UriMatchHost              = UriMatch(1)
+	UriMatchStartsWith        = UriMatch(2)
+	UriMatchExact             = UriMatch(3)
+	UriMatchRegularExpression = UriMatch(4)
+	UriMatchNever             = UriMatch(5)
+)
+
+var (
+	ErrIllegalUriMatch = errors.New("illegal uri match")
+)
+
+// Matches reports whether the given candidate (for example the URL of a
+// website) is matched by the stored uri using the semantics of this UriMatch
+// in the same way as Bitwarden does it for auto-fill.
+func (this UriMatch) Matches(uri, candidate string) bool {
+	switch this {
+	case UriMatchDomain:
+		a, b := baseDomainOf(uri), baseDomainOf(candidate)
+		return a != "" && a == b
+	case UriMatchHost:
+		a, b := hostOf(uri), hostOf(candidate)
+		return a != "" && a == b
+	case UriMatchStartsWith:
+		return strings.HasPrefix(candidate, uri)
+	case UriMatchExact:
+		return candidate == uri
+	case UriMatchRegularExpression:
+		r, err := regexp.Compile("(?i)" + uri)
+		if err != nil {
+			return false
+		}
+		return r.MatchString(candidate)
+	default:
+		return false
+	}
+}
+
+func (this UriMatch) String() string {
+	switch this {
+	case UriMatchDomain:
+		return "domain"
+	case UriMatchHost:
+		return "host"
+	case UriMatchStartsWith:
+		return "startsWith"
+	case UriMatchExact:
+		return "exact"
+	case UriMatchRegularExpression:
+		return "regularExpression"
+	case UriMatchNever:
+		return "never"
+	default:
+		return fmt.Sprintf("illegal-uri-match-%d", this)
+	}
+}
+
+func parseUri(plain string) *url.URL {
+	plain = strings.TrimSpace(plain)
+	if plain == "" {
+		return nil
+	}
+	if !strings.Contains(plain, "://") {
+		plain = "http://" + plain
+	}
+	result, err := url.Parse(plain)
+	if err != nil || result.Hostname() == "" {
+		return nil
+	}
+	return result
+}
+
+func hostOf(plain string) string {
+	u := parseUri(plain)
+	if u == nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+func baseDomainOf(plain string) string {
+	u := parseUri(plain)
+	if u == nil {
+		return ""
+	}
+	hostname := strings.ToLower(u.Hostname())
+	if hostname == "localhost" || net.ParseIP(hostname) != nil {
+		return hostname
+	}
+	result, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+	if err != nil {
+		return hostname
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package bitwarden
+
+import (
+	"testing"
+)
+
+func TestUriMatch_Matches(t *testing.T) {
+	cases := []struct {
+		name      string
+		match     UriMatch
+		uri       string
+		candidate string
+		expected  bool
+	}{
+		{"domain same host", UriMatchDomain, "https://example.com", "https://example.com/login", true},
+		{"domain sub domain", UriMatchDomain, "https://example.com", "https://accounts.example.com", true},
+		{"domain public suffix", UriMatchDomain, "https://foo.co.uk", "https://bar.co.uk", false},
+		{"domain without scheme", UriMatchDomain, "example.com", "https://www.example.com", true},
+		{"domain other", UriMatchDomain, "https://example.com", "https://example.org", false},
+		{"domain localhost", UriMatchDomain, "http://localhost:8080", "http://localhost:9090", true},
+		{"domain ip", UriMatchDomain, "http://10.0.0.1", "http://10.0.0.1:8080/x", true},
+		{"domain empty", UriMatchDomain, "", "https://example.com", false},
+		{"host same", UriMatchHost, "https://example.com:8443", "https://EXAMPLE.com:8443/x", true},
+		{"host other port", UriMatchHost, "https://example.com:8443", "https://example.com", false},
+		{"host sub domain", UriMatchHost, "https://example.com", "https://www.example.com", false},
+		{"startsWith prefix", UriMatchStartsWith, "https://example.com/app", "https://example.com/app/login", true},
+		{"startsWith other", UriMatchStartsWith, "https://example.com/app", "https://example.com/other", false},
+		{"exact same", UriMatchExact, "https://example.com/app", "https://example.com/app", true},
+		{"exact longer", UriMatchExact, "https://example.com/app", "https://example.com/app/", false},
+		{"regex match", UriMatchRegularExpression, `^https://[a-z]+\.example\.com/`, "https://Login.example.com/", true},
+		{"regex no match", UriMatchRegularExpression, `^https://example\.org`, "https://example.com", false},
+		{"regex illegal", UriMatchRegularExpression, `(`, "(", false},
+		{"never", UriMatchNever, "https://example.com", "https://example.com", false},
+		{"illegal", UriMatch(66), "https://example.com", "https://example.com", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := c.match.Matches(c.uri, c.candidate); actual != c.expected {
+				t.Errorf("%v.Matches(%q, %q) = %v; expected %v", c.match, c.uri, c.candidate, actual, c.expected)
+			}
+		})
+	}
+}
+
+func TestItemLoginUris_Matches(t *testing.T) {
+	exact := UriMatchExact
+	never := UriMatchNever
+	uris := ItemLoginUris{
+		{Match: &never, Uri: "https://ignored.example.org"},
+		{Match: &exact, Uri: "https://example.com/exact"},
+		{Uri: "https://example.net"},
+	}
+
+	cases := []struct {
+		candidate string
+		expected  bool
+	}{
+		{"https://ignored.example.org", false},
+		{"https://example.com/exact", true},
+		{"https://example.com/other", false},
+		{"https://www.example.net/login", true},
+	}
+	for _, c := range cases {
+		t.Run(c.candidate, func(t *testing.T) {
+			if actual := uris.Matches(c.candidate); actual != c.expected {
+				t.Errorf("Matches(%q) = %v; expected %v", c.candidate, actual, c.expected)
+			}
+		})
+	}
+}
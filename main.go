@@ -16,6 +16,7 @@ import (
 
 func main() {
 	p := plugin.NewPlugin()
+	p.RemoteStateReader = backend.RemoteStateReader{}
 	if p.ShouldServe() {
 		p.Serve()
 		return
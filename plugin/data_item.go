@@ -2,11 +2,13 @@ package plugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,6 +23,15 @@ func dataSourceItem() *schema.Resource {
 				Type:     schema.TypeString,
 				Optional: true,
 			},
+			"ignore_case": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"ambiguity_policy": &ambiguityPolicySchema,
+			"name_regex":       &nameRegexQuerySchema,
+			"uri":              &uriQuerySchema,
+			"field":            &fieldsQuerySchema,
 			"attachments_query": {
 				Type:     schema.TypeList,
 				Optional: true,
@@ -29,6 +40,12 @@ func dataSourceItem() *schema.Resource {
 			"id": &idSchema,
 			"type": {
 				Type:     schema.TypeInt,
+				Optional: true,
+				Computed: true,
+			},
+			"favorite": {
+				Type:     schema.TypeBool,
+				Optional: true,
 				Computed: true,
 			},
 			"reprompt": {
@@ -64,6 +81,8 @@ func dataSourceItem() *schema.Resource {
 					Type: schema.TypeString,
 				},
 			},
+			"attachments_decoded": &attachmentsDecodedSchema,
+			"attachment_refs":     &attachmentRefsSchema,
 		},
 	}
 }
@@ -80,18 +99,26 @@ func dataSourceItemRead(_ context.Context, d *schema.ResourceData, plainB interf
 		},
 	}
 
+	if err := parseItemFilter(d, &q.ItemFilter); err != nil {
+		return diag.FromErr(err)
+	}
+
 	var id string
 	if v, ok := d.Get("id").(string); ok && v != "" {
 		id = v
 	} else if v, ok := d.Get("name").(string); ok && v != "" {
 		q.Name = v
-	} else {
+		q.IgnoreCase = d.Get("ignore_case").(bool)
+	} else if q.ItemFilter.IsEmpty() {
 		return diag.Diagnostics{{
 			Severity: diag.Error,
-			Summary:  "Neither id nor name defined.",
-			Detail:   "There was neither the attribute id nor name defined.",
+			Summary:  "Neither id, name nor any other criteria defined.",
+			Detail:   "There was neither the attribute id, name nor any of name_regex, uri, field, type or favorite defined.",
 		}}
 	}
+	if v, ok := d.Get("ambiguity_policy").(string); ok {
+		q.OnAmbiguity = bitwarden.AmbiguityPolicy(v)
+	}
 	if v, ok := d.Get("organization_id").(string); ok {
 		q.OrganizationId = v
 	}
@@ -113,18 +140,20 @@ func dataSourceItemRead(_ context.Context, d *schema.ResourceData, plainB interf
 	} else {
 		item, err = b.FindItem(q)
 	}
+	var nuErr *bitwarden.ItemNotUniqueError
 	if err == bitwarden.ErrNoSuchItem {
 		return diag.Diagnostics{diag.Diagnostic{
 			Severity: diag.Error,
 			Summary:  "No such entry.",
-			Detail:   fmt.Sprintf("Cannot find entry named '%v'.", q.Name),
+			Detail:   fmt.Sprintf("Cannot find entry matching name '%v' and the other provided criteria.", q.Name),
 		}}
 	}
-	if err == bitwarden.ErrItemNotUnique {
+	if errors.As(err, &nuErr) {
 		return diag.Diagnostics{diag.Diagnostic{
 			Severity: diag.Error,
 			Summary:  "No unique entry.",
-			Detail:   fmt.Sprintf("Found more than one item matching name '%v'.", q.Name),
+			Detail: fmt.Sprintf("Found more than one item matching name '%v' and the other provided criteria which cannot be resolved using ambiguity_policy '%v'. Conflicting ids: %s",
+				q.Name, q.OnAmbiguity, strings.Join(nuErr.Ids(), ", ")),
 		}}
 	}
 	if err != nil {
@@ -19,7 +19,18 @@ func dataSourceItems() *schema.Resource {
 			"folder_id":       &folderIdSchema,
 			"search": {
 				Type:     schema.TypeString,
-				Required: true,
+				Optional: true,
+			},
+			"name_regex": &nameRegexQuerySchema,
+			"uri":        &uriQuerySchema,
+			"field":      &fieldsQuerySchema,
+			"type": {
+				Type:     schema.TypeInt,
+				Optional: true,
+			},
+			"favorite": {
+				Type:     schema.TypeBool,
+				Optional: true,
 			},
 			"attachments_query": {
 				Type:     schema.TypeList,
@@ -58,6 +69,10 @@ func dataSourceItemsRead(_ context.Context, d *schema.ResourceData, plainB inter
 		q.FolderId = v
 	}
 
+	if err := parseItemFilter(d, &q.ItemFilter); err != nil {
+		return diag.FromErr(err)
+	}
+
 	if err := q.Attachments.Parse(d.Get("attachments_query")); err != nil {
 		return diag.FromErr(err)
 	}
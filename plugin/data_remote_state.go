@@ -0,0 +1,202 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoSuchRevision = errors.New("no such revision")
+
+type RemoteStateReader interface {
+	ReadRemoteState(using *bitwarden.Bitwarden, q RemoteStateQuery) (*RemoteState, error)
+}
+
+type RemoteStateQuery struct {
+	ItemId          string
+	ItemName        string
+	OrganizationId  string
+	CollectionId    string
+	FolderId        string
+	AmbiguityPolicy bitwarden.AmbiguityPolicy
+
+	// Revision selects a specific historical revision of the state. If empty
+	// the latest revision will be used.
+	Revision string
+}
+
+type RemoteState struct {
+	Revision         string
+	Revisions        []string
+	Serial           int64
+	Lineage          string
+	TerraformVersion string
+	Outputs          map[string]RemoteStateOutput
+}
+
+type RemoteStateOutput struct {
+	Value     json.RawMessage `json:"value"`
+	Sensitive bool            `json:"sensitive"`
+}
+
+func (this *Plugin) dataSourceRemoteState() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: this.dataSourceRemoteStateRead,
+		Schema: map[string]*schema.Schema{
+			"organization_id":  &organizationIdSchema,
+			"collection_id":    &collectionIdSchema,
+			"folder_id":        &folderIdSchema,
+			"ambiguity_policy": &ambiguityPolicySchema,
+			"item_id": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ValidateDiagFunc: idSchema.ValidateDiagFunc,
+			},
+			"item_name": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"revision": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"revisions": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"serial": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"lineage": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"terraform_version": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"outputs": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"sensitive_outputs": {
+				Type:      schema.TypeMap,
+				Computed:  true,
+				Sensitive: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+		},
+	}
+}
+
+func (this *Plugin) dataSourceRemoteStateRead(_ context.Context, d *schema.ResourceData, plainB interface{}) (diags diag.Diagnostics) {
+	b := plainB.(*bitwarden.Bitwarden)
+	reader := this.RemoteStateReader
+	if reader == nil {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "Remote states not supported.",
+			Detail:   "This instance of the provider does not support reading remote states.",
+		}}
+	}
+
+	var q RemoteStateQuery
+	if v, ok := d.Get("item_id").(string); ok && v != "" {
+		q.ItemId = v
+	} else if v, ok := d.Get("item_name").(string); ok && v != "" {
+		q.ItemName = v
+	} else {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "Neither item_id nor item_name defined.",
+			Detail:   "There was neither the attribute item_id nor item_name defined.",
+		}}
+	}
+	if v, ok := d.Get("organization_id").(string); ok {
+		q.OrganizationId = v
+	}
+	if v, ok := d.Get("collection_id").(string); ok && v != "" {
+		q.CollectionId = v
+	}
+	if v, ok := d.Get("folder_id").(string); ok && v != "" {
+		q.FolderId = v
+	}
+	if v, ok := d.Get("ambiguity_policy").(string); ok {
+		q.AmbiguityPolicy = bitwarden.AmbiguityPolicy(v)
+	}
+	if v, ok := d.Get("revision").(string); ok {
+		q.Revision = v
+	}
+
+	state, err := reader.ReadRemoteState(b, q)
+	if errors.Is(err, bitwarden.ErrNoSuchItem) {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "No such entry.",
+			Detail:   fmt.Sprintf("Cannot find entry with id '%v' or named '%v'.", q.ItemId, q.ItemName),
+		}}
+	}
+	if errors.Is(err, ErrNoSuchRevision) {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "No such revision.",
+			Detail:   err.Error(),
+		}}
+	}
+	var nuErr *bitwarden.ItemNotUniqueError
+	if errors.As(err, &nuErr) {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "No unique entry.",
+			Detail: fmt.Sprintf("Found more than one item named '%v' which cannot be resolved using ambiguity_policy '%v'. Conflicting ids: %s",
+				q.ItemName, q.AmbiguityPolicy, strings.Join(nuErr.Ids(), ", ")),
+		}}
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	outputs, sensitiveOutputs := map[string]string{}, map[string]string{}
+	for k, v := range state.Outputs {
+		if v.Sensitive {
+			sensitiveOutputs[k] = string(v.Value)
+		} else {
+			outputs[k] = string(v.Value)
+		}
+	}
+
+	for k, v := range map[string]interface{}{
+		"revision":          state.Revision,
+		"revisions":         state.Revisions,
+		"serial":            int(state.Serial),
+		"lineage":           state.Lineage,
+		"terraform_version": state.TerraformVersion,
+		"outputs":           outputs,
+		"sensitive_outputs": sensitiveOutputs,
+	} {
+		if err := d.Set(k, v); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	d.SetId(strconv.FormatInt(time.Now().Unix(), 10))
+
+	return
+}
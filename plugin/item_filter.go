@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"regexp"
+)
+
+func parseItemFilter(d *schema.ResourceData, into *bitwarden.ItemFilter) error {
+	if v, ok := d.Get("uri").(string); ok && v != "" {
+		into.Uri = v
+	}
+	if err := into.Fields.Parse(d.Get("field")); err != nil {
+		return err
+	}
+	if v, ok := d.Get("name_regex").(string); ok && v != "" {
+		compiled, err := regexp.Compile(v)
+		if err != nil {
+			return fmt.Errorf("illegal name_regex provided: %w", err)
+		}
+		into.NameRegex = compiled
+	}
+
+	// type and favorite are also computed attributes of bitwarden_item, so
+	// only the raw configuration tells us whether they were really provided.
+	config := d.GetRawConfig()
+	if config.IsNull() || !config.IsKnown() {
+		return nil
+	}
+	if v := rawConfigAttr(config, "type"); !v.IsNull() {
+		i, _ := v.AsBigFloat().Int64()
+		into.Type = int(i)
+	}
+	if v := rawConfigAttr(config, "favorite"); !v.IsNull() {
+		b := v.True()
+		into.Favorite = &b
+	}
+
+	return nil
+}
+
+func rawConfigAttr(config cty.Value, name string) cty.Value {
+	if !config.Type().IsObjectType() || !config.Type().HasAttribute(name) {
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+	v := config.GetAttr(name)
+	if !v.IsKnown() {
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+	return v
+}
@@ -14,13 +14,18 @@ import (
 
 const EnvReattachProviders = "TF_REATTACH_PROVIDERS"
 
+const (
+	TerraformRegistryHostname = "registry.terraform.io"
+	OpenTofuRegistryHostname  = "registry.opentofu.org"
+)
+
 type BitwardenHolder interface {
 	Bitwarden() (*bitwarden.Bitwarden, error)
 }
 
 func NewPlugin() *Plugin {
 	return &Plugin{
-		ProviderAddr: "registry.terraform.io/echocat/bitwarden",
+		ProviderAddr: TerraformRegistryHostname + "/echocat/bitwarden",
 	}
 }
 
@@ -31,7 +36,8 @@ type Plugin struct {
 	closeCh    <-chan struct{}
 	config     plugin.ReattachConfig
 
-	BitwardenHolder BitwardenHolder
+	BitwardenHolder   BitwardenHolder
+	RemoteStateReader RemoteStateReader
 }
 
 func (this *Plugin) RegisterFlags(cmd *kingpin.CmdClause) {
@@ -57,7 +63,9 @@ func (this *Plugin) GetReattachProviders() map[string]plugin.ReattachConfig {
 func (this *Plugin) GetEnrichedReattachProviders() string {
 	providers := this.GetReattachProviders()
 
-	providers[this.ProviderAddr] = this.config
+	for _, addr := range this.providerAddrs() {
+		providers[addr] = this.config
+	}
 
 	b, err := json.Marshal(providers)
 	if err != nil {
@@ -67,6 +75,23 @@ func (this *Plugin) GetEnrichedReattachProviders() string {
 	return string(b)
 }
 
+// providerAddrs returns ProviderAddr and, if it points to one of the public
+// registries, also its counterpart of the other registry. Terraform resolves
+// sources without hostname via registry.terraform.io, OpenTofu via
+// registry.opentofu.org.
+func (this *Plugin) providerAddrs() []string {
+	result := []string{this.ProviderAddr}
+	for from, to := range map[string]string{
+		TerraformRegistryHostname: OpenTofuRegistryHostname,
+		OpenTofuRegistryHostname:  TerraformRegistryHostname,
+	} {
+		if strings.HasPrefix(this.ProviderAddr, from+"/") {
+			result = append(result, to+strings.TrimPrefix(this.ProviderAddr, from))
+		}
+	}
+	return result
+}
+
 func (this *Plugin) Initialize() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	config, closeCh, err := plugin.DebugServe(ctx, this.toOpts())
@@ -18,8 +18,9 @@ func (this *Plugin) provider() *schema.Provider {
 			},
 		},
 		DataSourcesMap: map[string]*schema.Resource{
-			"bitwarden_items": dataSourceItems(),
-			"bitwarden_item":  dataSourceItem(),
+			"bitwarden_items":        dataSourceItems(),
+			"bitwarden_item":         dataSourceItem(),
+			"bitwarden_remote_state": this.dataSourceRemoteState(),
 		},
 		ConfigureContextFunc: this.providerConfigure,
 	}
@@ -2,10 +2,12 @@ package plugin
 
 import (
 	"fmt"
+	"github.com/echocat/terraform-provider-bitwarden/bitwarden"
 	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"regexp"
 )
 
 var (
@@ -35,6 +37,10 @@ var (
 				Type:     schema.TypeString,
 				Computed: true,
 			},
+			"favorite": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
 			"username": {
 				Type:     schema.TypeString,
 				Computed: true,
@@ -65,6 +71,49 @@ var (
 					Type: schema.TypeString,
 				},
 			},
+			"attachments_decoded": &attachmentsDecodedSchema,
+			"attachment_refs":     &attachmentRefsSchema,
+		},
+	}
+
+	attachmentRefSchema = schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"file_name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"size": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"url": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+
+	attachmentRefsSchema = schema.Schema{
+		Type:     schema.TypeList,
+		Computed: true,
+		Elem:     &attachmentRefSchema,
+	}
+
+	// attachmentsDecodedSchema contains the decoded attachments as JSON
+	// documents. The plugin SDK (v2) only supports maps of primitive values
+	// and has no dynamic type; so the structure of the documents (which
+	// differs per attachment and format) cannot be expressed in the schema.
+	attachmentsDecodedSchema = schema.Schema{
+		Type:        schema.TypeMap,
+		Computed:    true,
+		Sensitive:   true,
+		Description: "Decoded attachments by the name of their query. Structured formats (json, yaml, dotenv, pem) are provided as JSON documents; use jsondecode() to access them. raw and base64 are provided as they are.",
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
 		},
 	}
 
@@ -83,11 +132,99 @@ var (
 				Optional: true,
 				Default:  false,
 			},
+			"format": {
+				Type:     schema.TypeString,
+				Optional: true,
+				ValidateDiagFunc: func(v interface{}, path cty.Path) (diags diag.Diagnostics) {
+					if vStr, ok := v.(string); ok {
+						if err := bitwarden.AttachmentFormat(vStr).Validate(); err != nil {
+							diags = append(diags, diag.Diagnostic{
+								Severity: diag.Error,
+								Summary:  "Illegal format.",
+								Detail:   fmt.Sprintf("Illegal format %v, expected one of: %v", vStr, bitwarden.AllAttachmentFormats),
+							})
+						}
+					}
+					return
+				},
+			},
 			"unique": {
 				Type:     schema.TypeBool,
 				Optional: true,
 				Default:  false,
 			},
+			"max_size": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				Default:  0,
+				ValidateDiagFunc: func(v interface{}, path cty.Path) (diags diag.Diagnostics) {
+					if vInt, ok := v.(int); ok && vInt < 0 {
+						diags = append(diags, diag.Diagnostic{
+							Severity: diag.Error,
+							Summary:  "Illegal max_size.",
+							Detail:   fmt.Sprintf("Illegal max_size %d, it has to be 0 (unlimited) or positive.", vInt),
+						})
+					}
+					return
+				},
+			},
+		},
+	}
+
+	fieldQuerySchema = schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"value": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+		},
+	}
+
+	uriQuerySchema = schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	}
+	fieldsQuerySchema = schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem:     &fieldQuerySchema,
+	}
+	nameRegexQuerySchema = schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+		ValidateDiagFunc: func(v interface{}, path cty.Path) (diags diag.Diagnostics) {
+			if vStr, ok := v.(string); ok && vStr != "" {
+				if _, err := regexp.Compile(vStr); err != nil {
+					diags = append(diags, diag.Diagnostic{
+						Severity: diag.Error,
+						Summary:  "Illegal name_regex.",
+						Detail:   fmt.Sprintf("Illegal name_regex %v: %v", vStr, err),
+					})
+				}
+			}
+			return
+		},
+	}
+
+	ambiguityPolicySchema = schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+		Default:  string(bitwarden.AmbiguityPolicyError),
+		ValidateDiagFunc: func(v interface{}, path cty.Path) (diags diag.Diagnostics) {
+			if vStr, ok := v.(string); ok {
+				if err := bitwarden.AmbiguityPolicy(vStr).Validate(); err != nil {
+					diags = append(diags, diag.Diagnostic{
+						Severity: diag.Error,
+						Summary:  "Illegal ambiguity_policy.",
+						Detail:   fmt.Sprintf("Illegal ambiguity_policy %v, expected one of: %v", vStr, bitwarden.AllAmbiguityPolicies),
+					})
+				}
+			}
+			return
 		},
 	}
 